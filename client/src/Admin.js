@@ -1,8 +1,14 @@
 import React, { useState, useEffect, useCallback } from 'react';
 import './App.css';
 import { ColorType } from 'lightweight-charts';
+import { apiFetch } from './api';
 
-const API_BASE_URL = 'http://localhost:8080/api';
+
+// Текст ошибки из ответа сервера
+const responseError = async (response, fallback) => {
+  const data = await response.json().catch(() => ({}));
+  return data.error || fallback;
+};
 
 const Admin = () => {
   const [tables, setTables] = useState([]);
@@ -16,13 +22,14 @@ const Admin = () => {
   const [editFormData, setEditFormData] = useState({});
   const [newRowData, setNewRowData] = useState({});
   const [query, setQuery] = useState('');
+  const [primaryKey, setPrimaryKey] = useState([]);
 
 
   // Загрузка списка таблиц
   const loadTables = useCallback(async () => {
     try {
       setIsLoading(true);
-      const response = await fetch(`${API_BASE_URL}/metadata`);
+      const response = await apiFetch(`/metadata`);
       if (!response.ok) throw new Error('Ошибка загрузки метаданных');
       
       const data = await response.json();
@@ -47,39 +54,25 @@ const Admin = () => {
       setIsLoading(true);
       setError('');
       setSuccessMessage('');
-      
-      const Sql= `SELECT * FROM ${tableName} LIMIT 1000`;
-
-      const response = await fetch(`${API_BASE_URL}/execute-query`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ Sql })
 
-      });
-      if (!response.ok) throw new Error('Ошибка загрузки данных');
+      const response = await apiFetch(`/tables/${encodeURIComponent(tableName)}/rows?limit=1000&total=none`);
+      if (!response.ok) throw new Error(await responseError(response, 'Ошибка загрузки данных'));
       
       const result = await response.json();
-      const data = result.data || result;
-      console.log(data)
-
+      const data = result.data || [];
+      setTableData(data);
+      setPrimaryKey(result.primaryKey || []);
 
         // Получаем названия колонок из первого элемента
         if (data.length > 0) {
-          setTableData(data);
           setColumns(Object.keys(data[0]));
-          console.log(data)
         } else {
           // Если данных нет, получаем колонки из метаданных
-          const metaResponse = await fetch(`${API_BASE_URL}/metadata`);
+          const metaResponse = await apiFetch(`/metadata`);
           const metadata = await metaResponse.json();
-          console.log(tableData)
-          metadata.metadata.tables.forEach(table => {
-            setColumns(table.columns.map(col => col.column_name));
-          })
-          console.log(columns)
+          const table = (metadata.metadata || metadata).tables?.find(t => t.table_name === tableName);
+          setColumns(table ? table.columns.map(col => col.column_name) : []);
         }
-
-      
       
     } catch (err) {
       setError(`Ошибка загрузки данных: ${err.message}`);
@@ -100,13 +93,13 @@ const Admin = () => {
       
       const Sql = query
 
-      const response = await fetch(`${API_BASE_URL}/sqlquery`, {
+      const response = await apiFetch(`/sqlquery`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ Sql })
       });
 
-      if (!response.ok) throw new Error('Ошибка выполнения запроса');
+      if (!response.ok) throw new Error(await responseError(response, 'Ошибка выполнения запроса'));
       const result = await response.json();
       setTableData(result.data);
       setColumns(Object.keys(result.data[0]));
@@ -121,31 +114,40 @@ const Admin = () => {
 
   }, [query]);
 
+  // Сегмент пути с первичным ключом строки: значение ключа из одной
+  // колонки или JSON-массив значений составного ключа
+  const rowPath = useCallback((tableName, row) => {
+    if (primaryKey.length === 0) {
+      throw new Error(`у таблицы ${tableName} нет первичного ключа`);
+    }
+    const key = primaryKey.length === 1
+      ? String(row[primaryKey[0]])
+      : JSON.stringify(primaryKey.map(column => row[column]));
+    return `/tables/${encodeURIComponent(tableName)}/rows/${encodeURIComponent(key)}`;
+  }, [primaryKey]);
+
   // Обновление строки
   const updateRow = useCallback(async (tableName, rowData, originalData) => {
     try {
       setIsLoading(true);
       
-      // Формируем SET часть запроса
-      const setClause = Object.entries(rowData)
-        .filter(([key]) => key in originalData)
-        .map(([key, value]) => `${key} = '${value}'`)
-        .join(', ');
-      
-      // Формируем WHERE часть запроса (используем оригинальные значения для идентификации строки)
-      const whereClause = Object.entries(originalData)
-        .map(([key, value]) => `${key} = '${value}'`)
-        .join(' AND ');
-      
-      const Sql = `UPDATE ${tableName} SET ${setClause} WHERE ${whereClause}`;
+      // Отправляем только измененные колонки
+      const changes = Object.fromEntries(
+        Object.entries(rowData).filter(([key, value]) => key in originalData && value !== originalData[key])
+      );
+      if (Object.keys(changes).length === 0) {
+        setEditingRow(null);
+        return;
+      }
       
-      const response = await fetch(`${API_BASE_URL}/updaterow`, {
-        method: 'POST',
+      // Строка определяется исходным значением первичного ключа
+      const response = await apiFetch(rowPath(tableName, originalData), {
+        method: 'PATCH',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ Sql })
+        body: JSON.stringify(changes)
       });
 
-      if (!response.ok) throw new Error('Ошибка обновления данных');
+      if (!response.ok) throw new Error(await responseError(response, 'Ошибка обновления данных'));
       
       setSuccessMessage('Данные успешно обновлены');
       setEditingRow(null);
@@ -156,7 +158,7 @@ const Admin = () => {
     } finally {
       setIsLoading(false);
     }
-  }, [loadTableData]);
+  }, [loadTableData, rowPath]);
 
   // -----Удаление строки
   const deleteRow = useCallback(async (tableName, rowData) => {
@@ -165,22 +167,11 @@ const Admin = () => {
   try {
     setIsLoading(true);
     
-    const whereClause = Object.entries(rowData)
-      .map(([key, value]) => `${key} = '${value}'`)
-      .join(' AND ');
-    
-    const Sql = `DELETE FROM ${tableName} WHERE ${whereClause}`;
-    
-    const response = await fetch(`${API_BASE_URL}/delrow`, {
-      method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ Sql })
-    });
+    const response = await apiFetch(rowPath(tableName, rowData), { method: 'DELETE' });
     
-    if (!response.ok) throw new Error('Ошибка удаления данных');
+    if (!response.ok) throw new Error(await responseError(response, 'Ошибка удаления данных'));
     
-    const result = await response.json();
-    setSuccessMessage(`Запись успешно удалена (затронуто строк: ${result.rows_affected})`);
+    setSuccessMessage('Запись успешно удалена');
     
     // Автоматически обновляем данные таблицы
     loadTableData(tableName);
@@ -190,25 +181,25 @@ const Admin = () => {
   } finally {
     setIsLoading(false);
   }
-}, [loadTableData]);
+}, [loadTableData, rowPath]);
 
   // Добавление новой строки
   const addRow = useCallback(async (tableName, rowData) => {
     try {
       setIsLoading(true);
       
-      const columns = Object.keys(rowData).join(', ');
-      const values = Object.values(rowData).map(value => `'${value}'`).join(', ');
+      // Пустые поля не передаются: для них действуют значения по умолчанию
+      const values = Object.fromEntries(
+        Object.entries(rowData).filter(([, value]) => value !== '')
+      );
       
-      const Sql = `INSERT INTO ${tableName} (${columns}) VALUES (${values})`;
-      
-      const response = await fetch(`${API_BASE_URL}/addrow`, {
+      const response = await apiFetch(`/tables/${encodeURIComponent(tableName)}/rows`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ Sql })
+        body: JSON.stringify(values)
       });
 
-      if (!response.ok) throw new Error('Ошибка добавления данных');
+      if (!response.ok) throw new Error(await responseError(response, 'Ошибка добавления данных'));
       
       setSuccessMessage('Запись успешно добавлена');
       setNewRowData({});
@@ -230,13 +221,13 @@ const Admin = () => {
       
       const Sql = `DELETE FROM ${tableName}`;
 
-      const response = await fetch(`${API_BASE_URL}/deltable`, {
+      const response = await apiFetch(`/deltable`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ Sql })
       });
 
-      if (!response.ok) throw new Error('Ошибка очистки таблицы');
+      if (!response.ok) throw new Error(await responseError(response, 'Ошибка очистки таблицы'));
       
       setSuccessMessage('Таблица успешно очищена');
       loadTableData(tableName);
@@ -462,6 +453,7 @@ const Admin = () => {
                                   <button
                                     className="btn btn-warning btn-sm me-1"
                                     onClick={() => handleEditClick(row, index)}
+                                    disabled={primaryKey.length === 0}
                                     title="Редактировать"
                                   >
                                     <i className="bi bi-pencil"></i>
@@ -469,6 +461,7 @@ const Admin = () => {
                                   <button
                                     className="btn btn-danger btn-sm"
                                     onClick={() => deleteRow(selectedTable, row)}
+                                    disabled={primaryKey.length === 0}
                                     title="Удалить"
                                   >
                                     <i className="bi bi-trash"></i>
@@ -476,13 +469,13 @@ const Admin = () => {
                                 </>
                               )}
                             </td>
-                            {Object.keys(row).map((column) => (
+                            {columns.map((column) => (
                               <td key={column}>
                                 {editingRow === index ? (
                                   <input
                                     type="text"
                                     className="form-control form-control-sm"
-                                    value={editFormData[column] || ''}
+                                    value={editFormData[column] ?? ''}
                                     onChange={(e) => handleEditFormChange(column, e.target.value)}
                                   />
                                 ) : (
@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useCallback } from 'react';
-import { Routes, Route } from 'react-router-dom';
+import { Routes, Route, Navigate, useLocation } from 'react-router-dom';
 import './App.css';
 import 'bootstrap/dist/css/bootstrap.min.css';
 import 'bootstrap-icons/font/bootstrap-icons.css';
@@ -7,6 +7,18 @@ import Navbar from './components/Navbar';
 import Graph from './Graph.js';
 import Main from './Main.js';
 import Admin from './Admin.js';
+import Login from './Login.js';
+import { getTokens } from './api';
+
+// Страницы, требующие входа: без токенов открывается страница входа
+const RequireAuth = ({ children }) => {
+  const location = useLocation();
+  if (!getTokens()) {
+    const next = encodeURIComponent(location.pathname + location.search);
+    return <Navigate to={`/login?next=${next}`} replace />;
+  }
+  return children;
+};
 
 
 function App() {
@@ -15,9 +27,10 @@ function App() {
     <div className='erd-container d-flex flex-column vh-100'>
         <Navbar />
         <Routes>
-          <Route path="/" element={<Main />} />
-          <Route path="/graph" element={<Graph />} />
-          <Route path="/admin" element={<Admin />} />
+          <Route path="/login" element={<Login />} />
+          <Route path="/" element={<RequireAuth><Main /></RequireAuth>} />
+          <Route path="/graph" element={<RequireAuth><Graph /></RequireAuth>} />
+          <Route path="/admin" element={<RequireAuth><Admin /></RequireAuth>} />
         </Routes>
         
     </div>
@@ -6,10 +6,10 @@ import Navbar from './components/Navbar';
 import ChartsContainer from './components/ChartsContainer';
 import SqlPanel from './components/SqlPanel';
 import ChartTypeModal from './components/ChartTypeModal';
+import { apiFetch } from './api';
 
 // Константы
 const MAX_CHARTS = 6;
-const API_BASE_URL = process.env.REACT_APP_API_URL;
 
 function transformData(inputJson, xAxis = 'Measurement_time', yAxis = 'Current_value') {
   let transformedData = inputJson.map(item => ({
@@ -52,7 +52,7 @@ function Graph() {
 // Функции для управления генерацией
 const startDataGeneration = useCallback(async () => {
   try {
-    const response = await fetch(`${API_BASE_URL}/api/generation/start`, {
+    const response = await apiFetch(`/generation/start`, {
       method: 'POST'
     });
     
@@ -67,7 +67,7 @@ const startDataGeneration = useCallback(async () => {
 
 const stopDataGeneration = useCallback(async () => {
   try {
-    const response = await fetch(`${API_BASE_URL}/api/generation/stop`, {
+    const response = await apiFetch(`/generation/stop`, {
       method: 'POST'
     });
     
@@ -84,7 +84,7 @@ const stopDataGeneration = useCallback(async () => {
 useEffect(() => {
   const checkGenerationStatus = async () => {
     try {
-      const response = await fetch(`${API_BASE_URL}/api/generation/status`);
+      const response = await apiFetch(`/generation/status`);
 	
       if (response.ok) {
         const status = await response.json();
@@ -188,7 +188,7 @@ useEffect(() => {
   useEffect(() => {
     const loadNamesData = async () => {
       try {
-        const response = await fetch(`${API_BASE_URL}/api/metadata`);
+        const response = await apiFetch(`/metadata`);
         if (!response.ok) {
           throw new Error(`HTTP error! status: ${response.status}`);
         }
@@ -206,7 +206,7 @@ useEffect(() => {
   // Функция для получения новых данных
   const fetchNewData = useCallback(async () => {
     try {
-      const response = await fetch(`${API_BASE_URL}/api/getparams`);
+      const response = await apiFetch(`/getparams`);
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
       }
@@ -233,7 +233,7 @@ useEffect(() => {
   // Обработчик SQL запросов
 const handleExecuteQuery = useCallback(async (query, chartId = null, seriesId = null) => {
     try {
-        const response = await fetch(`${API_BASE_URL}/api/execute-query`, {
+        const response = await apiFetch(`/execute-query`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ Sql: query })
@@ -15,6 +15,7 @@ import 'reactflow/dist/style.css';
 import './Graph.css';
 import Sidebar from './components/Sidebar';
 import Chart from './components/Chart';
+import { apiFetch } from './api';
 
 // Кастомный узел для графика
 const ChartNode = ({ data, isConnectable, selected, id }) => {
@@ -62,7 +63,7 @@ const ChartNode = ({ data, isConnectable, selected, id }) => {
 
     //console.log('Выполняем SQL:', sql);
     
-    const response = await fetch('http://localhost:8080/api/execute-query', {
+    const response = await apiFetch('/execute-query', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ sql })
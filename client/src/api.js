@@ -0,0 +1,119 @@
+// Обращения к API сервера с access-токеном.
+// Токены хранятся в localStorage; при ответе 401 пара обновляется
+// через /auth/refresh, а если обновить не удалось - открывается страница входа.
+
+export const API_BASE_URL = `${process.env.REACT_APP_API_URL || 'http://localhost:8080'}/api`;
+
+const TOKENS_KEY = 'eps.tokens';
+const USER_KEY = 'eps.user';
+
+export const getTokens = () => {
+  try {
+    return JSON.parse(localStorage.getItem(TOKENS_KEY));
+  } catch {
+    return null;
+  }
+};
+
+export const getUser = () => {
+  try {
+    return JSON.parse(localStorage.getItem(USER_KEY));
+  } catch {
+    return null;
+  }
+};
+
+const saveSession = ({ user, tokens }) => {
+  localStorage.setItem(TOKENS_KEY, JSON.stringify(tokens));
+  localStorage.setItem(USER_KEY, JSON.stringify(user));
+};
+
+const clearSession = () => {
+  localStorage.removeItem(TOKENS_KEY);
+  localStorage.removeItem(USER_KEY);
+};
+
+const redirectToLogin = () => {
+  clearSession();
+  if (window.location.pathname !== '/login') {
+    const next = encodeURIComponent(window.location.pathname + window.location.search);
+    window.location.assign(`/login?next=${next}`);
+  }
+};
+
+// Вход по логину и паролю; сохраняет пользователя и пару токенов
+export const login = async (username, password) => {
+  const response = await fetch(`${API_BASE_URL}/auth/login`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ username, password }),
+  });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new Error(data.error || `HTTP ${response.status}`);
+  }
+  saveSession(data);
+  return data.user;
+};
+
+// Выход: отзывает refresh-токен на сервере и очищает сессию
+export const logout = async () => {
+  const tokens = getTokens();
+  if (tokens?.refreshToken) {
+    await fetch(`${API_BASE_URL}/auth/logout`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken: tokens.refreshToken }),
+    }).catch(() => {});
+  }
+  redirectToLogin();
+};
+
+// Одновременные 401 ждут один и тот же обмен refresh-токена:
+// повторный обмен уже отозванного токена сервер отклонит
+let refreshing = null;
+
+const refreshTokens = () => {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const tokens = getTokens();
+      if (!tokens?.refreshToken) return false;
+      const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refreshToken: tokens.refreshToken }),
+      });
+      if (!response.ok) return false;
+      saveSession(await response.json());
+      return true;
+    })()
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+const withAuth = (options = {}) => {
+  const headers = new Headers(options.headers);
+  const tokens = getTokens();
+  if (tokens?.accessToken) {
+    headers.set('Authorization', `${tokens.tokenType || 'Bearer'} ${tokens.accessToken}`);
+  }
+  return { ...options, headers };
+};
+
+// fetch к API с заголовком Authorization; path - путь относительно /api
+export const apiFetch = async (path, options = {}) => {
+  const url = `${API_BASE_URL}${path}`;
+  let response = await fetch(url, withAuth(options));
+  if (response.status !== 401) return response;
+
+  if (await refreshTokens()) {
+    response = await fetch(url, withAuth(options));
+    if (response.status !== 401) return response;
+  }
+  redirectToLogin();
+  return response;
+};
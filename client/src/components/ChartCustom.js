@@ -1,6 +1,7 @@
 import React, { useEffect, useRef, useState, useCallback, useMemo } from 'react';
 
 import Chart from './Chart.js'
+import { apiFetch } from '../api';
 
 const ChartCustom = ({ 
   data = [], 
@@ -917,7 +918,7 @@ const processChartData = useCallback((rawData, seriesId = 'main') => {
   // Запуск/остановка генерации через API
   const handleStartGeneration = useCallback(async () => {
     try {
-      const response = await fetch('http://localhost:8080/api/generation/start', {
+      const response = await apiFetch('/generation/start', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -938,7 +939,7 @@ const processChartData = useCallback((rawData, seriesId = 'main') => {
 
   const handleStopGeneration = useCallback(async () => {
     try {
-      const response = await fetch('http://localhost:8080/api/generation/stop', {
+      const response = await apiFetch('/generation/stop', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -1,12 +1,26 @@
 import './navbar.css'
+import { useLocation } from 'react-router-dom';
+import { getUser, logout } from '../api';
+
 export default function Navbar() {
+  useLocation(); // перерисовка после входа и смены страницы
+  const user = getUser();
   return (
     <nav className="navbar navbar-dark bg-dark">
       <div className="container-fluid bg-dark">
         <a className="navbar-brand fw-bold" href="/">EPS</a>
 
         {/* Ссылка на админ-панель справа в виде кнопки */}
-        <div className="d-flex">
+        <div className="d-flex align-items-center">
+          {user && (
+            <>
+              <span className="text-light small me-2">{user.username} ({user.role})</span>
+              <button className="btn btn-outline-light btn-sm me-2" onClick={logout}>
+                <i className="bi bi-box-arrow-right me-1"></i>
+                Выйти
+              </button>
+            </>
+          )}
           <a className="btn btn-outline-light btn-sm" href="/admin">
             <i className="bi bi-gear-fill me-1"></i>
             Админ-панель
@@ -1,7 +1,7 @@
 import React, { useState, useRef, useEffect, useCallback } from 'react';
 import './Sidebar.css';
+import { apiFetch } from '../api';
 
-const API_BASE_URL = 'http://localhost:8080/api';
 
 const Sidebar = ({ 
   width = 300, 
@@ -55,7 +55,7 @@ const Sidebar = ({
     try {
       setChartParams(prev => ({ ...prev, isLoadingParams: true, paramError: '' }));
       
-      const response = await fetch(`${API_BASE_URL}/metadata`);
+      const response = await apiFetch(`/metadata`);
       if (!response.ok) throw new Error('Ошибка загрузки метаданных');
       
       const data = await response.json();
@@ -87,7 +87,7 @@ const Sidebar = ({
       
       const sql = `SELECT * FROM ${tableName} ORDER BY 1 ASC`; // Сортируем по первому столбцу
       
-      const response = await fetch(`${API_BASE_URL}/execute-query`, {
+      const response = await apiFetch(`/execute-query`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ sql })
@@ -120,7 +120,7 @@ const Sidebar = ({
         }));
       } else {
         // Если данных нет, получаем колонки из метаданных
-        const metaResponse = await fetch(`${API_BASE_URL}/metadata`);
+        const metaResponse = await apiFetch(`/metadata`);
         const metadata = await metaResponse.json();
         
         const table = metadata.metadata?.tables?.find(t => t.table_name === tableName);
@@ -250,7 +250,7 @@ const Sidebar = ({
     setGenerationState(prev => ({ ...prev, isLoading: true }));
     
     try {
-      const response = await fetch(`${API_BASE_URL}/generation/start`, {
+      const response = await apiFetch(`/generation/start`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
@@ -278,7 +278,7 @@ const Sidebar = ({
     setGenerationState(prev => ({ ...prev, isLoading: true }));
     
     try {
-      const response = await fetch(`${API_BASE_URL}/generation/stop`, {
+      const response = await apiFetch(`/generation/stop`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' }
       });
@@ -301,7 +301,7 @@ const Sidebar = ({
   useEffect(() => {
     const checkStatus = async () => {
       try {
-        const response = await fetch(`${API_BASE_URL}/generation/status`);
+        const response = await apiFetch(`/generation/status`);
         if (response.ok) {
           const data = await response.json();
           setGenerationState(prev => ({ 
@@ -0,0 +1,632 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"EPS/database"
+	"EPS/routes"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Файлы конфигурации, которые ищутся в рабочем каталоге, если EPS_CONFIG не задан
+var defaultFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// Конфигурация сервера
+type Config struct {
+	Database  database.Config `yaml:"database"`
+	Server    ServerConfig    `yaml:"server"`
+	Generator GeneratorConfig `yaml:"generator"`
+	Stream    StreamConfig    `yaml:"stream"`
+	Writer    WriterConfig    `yaml:"writer"`
+	Rollup    RollupConfig    `yaml:"rollup"`
+	Retention RetentionConfig `yaml:"retention"`
+	Partition PartitionConfig `yaml:"partitioning"`
+	Auth      AuthConfig      `yaml:"auth"`
+	SQL       SQLConfig       `yaml:"sql"`
+}
+
+// Параметры HTTP сервера
+type ServerConfig struct {
+	Listen      string   `yaml:"listen"`       // адрес, например ":8080"
+	TLSCert     string   `yaml:"tls_cert"`     // путь к сертификату; пусто - без TLS
+	TLSKey      string   `yaml:"tls_key"`      // путь к ключу
+	CORSOrigins []string `yaml:"cors_origins"` // разрешенные источники запросов
+	AutoMigrate bool     `yaml:"auto_migrate"` // применять миграции при запуске
+}
+
+// Параметры генерации по умолчанию
+type GeneratorConfig struct {
+	Interval    int    `yaml:"interval"` // мс
+	Table       string `yaml:"table"`
+	CircuitID   string `yaml:"circuit_id"`
+	SensorModel string `yaml:"sensor_model"`
+}
+
+// Параметры потоковой передачи по WebSocket
+type StreamConfig struct {
+	SendQueueSize int           `yaml:"send_queue_size"`
+	Overflow      string        `yaml:"overflow"`
+	WriteTimeout  time.Duration `yaml:"write_timeout"`
+	PongTimeout   time.Duration `yaml:"pong_timeout"`
+}
+
+// Параметры асинхронной записи измерений
+type WriterConfig struct {
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	QueueSize     int           `yaml:"queue_size"`
+	MaxRetries    int           `yaml:"max_retries"`
+	RetryBackoff  time.Duration `yaml:"retry_backoff"`
+}
+
+// Параметры фонового расчета агрегатов
+type RollupConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Interval  time.Duration `yaml:"interval"`
+	BatchSize int           `yaml:"batch_size"`
+}
+
+// Параметры очистки устаревших данных
+type RetentionConfig struct {
+	Interval   time.Duration   `yaml:"interval"`    // период запуска задания
+	BatchSize  int             `yaml:"batch_size"`  // строк за одну транзакцию удаления
+	DryRun     bool            `yaml:"dry_run"`     // только отчет в журнале, без удаления
+	ArchiveDir string          `yaml:"archive_dir"` // каталог архива CSV.gz
+	Rules      []RetentionRule `yaml:"rules"`
+}
+
+// Правило хранения таблицы или одной цепи
+type RetentionRule struct {
+	Table      string          `yaml:"table"`
+	Circuit    string          `yaml:"circuit"`     // пусто - все цепи
+	TimeColumn string          `yaml:"time_column"` // пусто - measurement_time (bucket для агрегатов)
+	Keep       RetentionPeriod `yaml:"keep"`        // например "30d", "5y", "720h"
+	Archive    bool            `yaml:"archive"`     // выгрузить строки в архив перед удалением
+}
+
+// Срок хранения: длительность Go или число дней (d) и лет (y, 365 дней)
+type RetentionPeriod time.Duration
+
+func (p *RetentionPeriod) UnmarshalYAML(node *yaml.Node) error {
+	var text string
+	if err := node.Decode(&text); err != nil {
+		return err
+	}
+	d, err := parseRetentionPeriod(text)
+	if err != nil {
+		return err
+	}
+	*p = RetentionPeriod(d)
+	return nil
+}
+
+func parseRetentionPeriod(text string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "y": 365 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(text, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count <= 0 {
+				return 0, fmt.Errorf("неверный срок хранения %q", text)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("неверный срок хранения %q", text)
+	}
+	return d, nil
+}
+
+// Параметры секционирования таблиц по времени
+type PartitionConfig struct {
+	CheckInterval time.Duration    `yaml:"check_interval"` // период создания будущих секций
+	Tables        []PartitionTable `yaml:"tables"`
+}
+
+// Секционируемая таблица
+type PartitionTable struct {
+	Table   string `yaml:"table"`
+	Column  string `yaml:"column"`  // пусто - measurement_time (bucket для агрегатов)
+	Period  string `yaml:"period"`  // day или month
+	Premake int    `yaml:"premake"` // будущих секций заранее; 0 - 7 дней или 2 месяца
+}
+
+// Параметры аутентификации
+type AuthConfig struct {
+	JWTSecret     string        `yaml:"jwt_secret"`     // ключ подписи токенов, не короче 32 байт
+	AccessTTL     time.Duration `yaml:"access_ttl"`     // время жизни access-токена
+	RefreshTTL    time.Duration `yaml:"refresh_ttl"`    // время жизни refresh-токена
+	AllowRegister bool          `yaml:"allow_register"` // открытая регистрация с ролью viewer
+	Admin         AdminConfig   `yaml:"admin"`
+
+	// Минимальные роли для действий над отдельными таблицами, например
+	// current_measurements: {edit_rows: admin}
+	TablePermissions routes.TablePermissions `yaml:"table_permissions"`
+}
+
+// Администратор, создаваемый при первом запуске
+type AdminConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Ограничения пользовательского SQL
+type SQLConfig struct {
+	Tables    []string `yaml:"tables"`    // доступные таблицы; пусто - все таблицы приложения
+	Functions []string `yaml:"functions"` // функции сверх встроенного списка безопасных
+
+	StatementTimeout time.Duration `yaml:"statement_timeout"` // лимит времени запроса на чтение
+	MaxRows          int           `yaml:"max_rows"`          // максимум строк в ответе
+	Role             string        `yaml:"role"`              // роль БД с правами только на чтение
+}
+
+// Значения по умолчанию. Пароль БД по умолчанию не задан.
+func Default() Config {
+	stream := routes.DefaultStreamConfig()
+	writer := routes.DefaultWriterConfig()
+	sql := routes.DefaultSQLConfig()
+	rollup := routes.DefaultRollupConfig()
+	retention := routes.DefaultRetentionConfig()
+	partition := routes.DefaultPartitionConfig()
+
+	return Config{
+		Database: database.Config{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			DBName:  "test",
+			SSLMode: "disable",
+		},
+		Server: ServerConfig{
+			Listen:      ":8080",
+			CORSOrigins: []string{"http://localhost:3000", "http://visualgraph.ru", "http://www.visualgraph.ru"},
+			AutoMigrate: true,
+		},
+		Generator: GeneratorConfig{
+			Interval:    20,
+			Table:       "current_measurements",
+			CircuitID:   "circuit_B",
+			SensorModel: "I-Sensor-Pro",
+		},
+		Stream: StreamConfig{
+			SendQueueSize: stream.SendQueueSize,
+			Overflow:      string(stream.Overflow),
+			WriteTimeout:  stream.WriteTimeout,
+			PongTimeout:   stream.PongTimeout,
+		},
+		Writer: WriterConfig{
+			BatchSize:     writer.BatchSize,
+			FlushInterval: writer.FlushInterval,
+			QueueSize:     writer.QueueSize,
+			MaxRetries:    writer.MaxRetries,
+			RetryBackoff:  writer.RetryBackoff,
+		},
+		Rollup: RollupConfig{
+			Enabled:   rollup.Enabled,
+			Interval:  rollup.Interval,
+			BatchSize: rollup.BatchSize,
+		},
+		Retention: RetentionConfig{
+			Interval:  retention.Interval,
+			BatchSize: retention.BatchSize,
+		},
+		Partition: PartitionConfig{
+			CheckInterval: partition.CheckInterval,
+		},
+		SQL: SQLConfig{
+			StatementTimeout: sql.StatementTimeout,
+			MaxRows:          sql.MaxRows,
+		},
+		Auth: AuthConfig{
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load собирает конфигурацию: значения по умолчанию, затем файл
+// (EPS_CONFIG или config.yaml/config.toml в рабочем каталоге), затем
+// переменные окружения EPS_*. Результат проверяется.
+func Load() (Config, error) {
+	cfg := Default()
+
+	path, required := os.Getenv("EPS_CONFIG"), true
+	if path == "" {
+		required = false
+		for _, name := range defaultFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			if required || !errors.Is(err, os.ErrNotExist) {
+				return cfg, err
+			}
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Читает файл YAML или TOML (по расширению) поверх текущих значений
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("чтение конфигурации: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML приводится к YAML, чтобы у обоих форматов была одна схема
+		// и одинаковый разбор длительностей ("30s", "5m")
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: неизвестный формат конфигурации, ожидается .yaml или .toml", path)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Переопределение параметра из переменной окружения
+type envVar struct {
+	name string
+	set  func(string) error
+}
+
+func (cfg *Config) envVars() []envVar {
+	return []envVar{
+		{"EPS_DB_HOST", setString(&cfg.Database.Host)},
+		{"EPS_DB_PORT", setInt(&cfg.Database.Port)},
+		{"EPS_DB_USER", setString(&cfg.Database.User)},
+		{"EPS_DB_PASSWORD", setString(&cfg.Database.Password)},
+		{"EPS_DB_NAME", setString(&cfg.Database.DBName)},
+		{"EPS_DB_SSLMODE", setString(&cfg.Database.SSLMode)},
+		{"EPS_DB_MAX_OPEN_CONNS", setInt(&cfg.Database.MaxOpenConns)},
+		{"EPS_DB_MAX_IDLE_CONNS", setInt(&cfg.Database.MaxIdleConns)},
+		{"EPS_DB_CONN_MAX_LIFETIME", setDuration(&cfg.Database.ConnMaxLifetime)},
+
+		{"EPS_LISTEN_ADDR", setString(&cfg.Server.Listen)},
+		{"EPS_TLS_CERT", setString(&cfg.Server.TLSCert)},
+		{"EPS_TLS_KEY", setString(&cfg.Server.TLSKey)},
+		{"EPS_CORS_ORIGINS", setList(&cfg.Server.CORSOrigins)},
+		{"EPS_AUTO_MIGRATE", setBool(&cfg.Server.AutoMigrate)},
+
+		{"EPS_GEN_INTERVAL", setInt(&cfg.Generator.Interval)},
+		{"EPS_GEN_TABLE", setString(&cfg.Generator.Table)},
+		{"EPS_GEN_CIRCUIT_ID", setString(&cfg.Generator.CircuitID)},
+		{"EPS_GEN_SENSOR_MODEL", setString(&cfg.Generator.SensorModel)},
+
+		{"EPS_WS_SEND_QUEUE_SIZE", setInt(&cfg.Stream.SendQueueSize)},
+		{"EPS_WS_OVERFLOW", setString(&cfg.Stream.Overflow)},
+		{"EPS_WS_WRITE_TIMEOUT", setDuration(&cfg.Stream.WriteTimeout)},
+		{"EPS_WS_PONG_TIMEOUT", setDuration(&cfg.Stream.PongTimeout)},
+
+		{"EPS_WRITER_BATCH_SIZE", setInt(&cfg.Writer.BatchSize)},
+		{"EPS_WRITER_FLUSH_INTERVAL", setDuration(&cfg.Writer.FlushInterval)},
+		{"EPS_WRITER_QUEUE_SIZE", setInt(&cfg.Writer.QueueSize)},
+		{"EPS_WRITER_MAX_RETRIES", setInt(&cfg.Writer.MaxRetries)},
+		{"EPS_WRITER_RETRY_BACKOFF", setDuration(&cfg.Writer.RetryBackoff)},
+		{"EPS_ROLLUP_ENABLED", setBool(&cfg.Rollup.Enabled)},
+		{"EPS_ROLLUP_INTERVAL", setDuration(&cfg.Rollup.Interval)},
+		{"EPS_ROLLUP_BATCH_SIZE", setInt(&cfg.Rollup.BatchSize)},
+
+		{"EPS_RETENTION_INTERVAL", setDuration(&cfg.Retention.Interval)},
+		{"EPS_RETENTION_BATCH_SIZE", setInt(&cfg.Retention.BatchSize)},
+		{"EPS_RETENTION_DRY_RUN", setBool(&cfg.Retention.DryRun)},
+		{"EPS_RETENTION_ARCHIVE_DIR", setString(&cfg.Retention.ArchiveDir)},
+		{"EPS_PARTITION_CHECK_INTERVAL", setDuration(&cfg.Partition.CheckInterval)},
+
+		{"EPS_SQL_TABLES", setList(&cfg.SQL.Tables)},
+		{"EPS_SQL_FUNCTIONS", setList(&cfg.SQL.Functions)},
+		{"EPS_SQL_STATEMENT_TIMEOUT", setDuration(&cfg.SQL.StatementTimeout)},
+		{"EPS_SQL_MAX_ROWS", setInt(&cfg.SQL.MaxRows)},
+		{"EPS_SQL_ROLE", setString(&cfg.SQL.Role)},
+
+		{"EPS_JWT_SECRET", setString(&cfg.Auth.JWTSecret)},
+		{"EPS_AUTH_ACCESS_TTL", setDuration(&cfg.Auth.AccessTTL)},
+		{"EPS_AUTH_REFRESH_TTL", setDuration(&cfg.Auth.RefreshTTL)},
+		{"EPS_AUTH_ALLOW_REGISTER", setBool(&cfg.Auth.AllowRegister)},
+		{"EPS_ADMIN_USERNAME", setString(&cfg.Auth.Admin.Username)},
+		{"EPS_ADMIN_PASSWORD", setString(&cfg.Auth.Admin.Password)},
+	}
+}
+
+// Применяет переменные окружения; ошибки разбора собираются все сразу
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, v := range cfg.envVars() {
+		value, ok := lookup(v.name)
+		if !ok {
+			continue
+		}
+		if err := v.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setString(dst *string) func(string) error {
+	return func(v string) error {
+		*dst = v
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", v)
+		}
+		*dst = n
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("ожидается true или false, получено %q", v)
+		}
+		*dst = b
+		return nil
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("ожидается длительность вида 500ms, 30s, 5m, получено %q", v)
+		}
+		*dst = d
+		return nil
+	}
+}
+
+// Список через запятую
+func setList(dst *[]string) func(string) error {
+	return func(v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*dst = list
+		return nil
+	}
+}
+
+// Режимы sslmode, поддерживаемые libpq и pgx
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки
+func (cfg Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	db := cfg.Database
+	if db.Host == "" {
+		fail("database.host", "не задан")
+	}
+	if db.Port <= 0 || db.Port > 65535 {
+		fail("database.port", "должен быть в диапазоне 1..65535, получено %d", db.Port)
+	}
+	if db.User == "" {
+		fail("database.user", "не задан")
+	}
+	if db.DBName == "" {
+		fail("database.dbname", "не задано")
+	}
+	if !contains(sslModes, db.SSLMode) {
+		fail("database.sslmode", "неизвестный режим %q, допустимо: %s", db.SSLMode, strings.Join(sslModes, ", "))
+	}
+	if db.MaxOpenConns < 0 || db.MaxIdleConns < 0 || db.ConnMaxLifetime < 0 {
+		fail("database", "параметры пула соединений не могут быть отрицательными")
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		fail("database.max_idle_conns", "больше max_open_conns (%d > %d)", db.MaxIdleConns, db.MaxOpenConns)
+	}
+
+	srv := cfg.Server
+	if _, _, err := net.SplitHostPort(srv.Listen); err != nil {
+		fail("server.listen", "неверный адрес %q, ожидается host:port или :port", srv.Listen)
+	}
+	if (srv.TLSCert == "") != (srv.TLSKey == "") {
+		fail("server", "tls_cert и tls_key задаются только вместе")
+	}
+	for field, path := range map[string]string{"server.tls_cert": srv.TLSCert, "server.tls_key": srv.TLSKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			fail(field, "файл недоступен: %v", err)
+		}
+	}
+	if len(srv.CORSOrigins) == 0 {
+		fail("server.cors_origins", "список пуст")
+	}
+	for _, origin := range srv.CORSOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			fail("server.cors_origins", "неверный источник %q, ожидается http(s)://host[:port]", origin)
+		}
+	}
+
+	if err := routes.ValidateGenerationDefaults(cfg.Generator.Defaults()); err != nil {
+		fail("generator", "%v", err)
+	}
+	if err := routes.ValidateStreamConfig(cfg.Stream.Routes()); err != nil {
+		fail("stream", "%v", err)
+	}
+	if err := routes.ValidateWriterConfig(cfg.Writer.Routes()); err != nil {
+		fail("writer", "%v", err)
+	}
+	if err := routes.ValidateRollupConfig(cfg.Rollup.Routes()); err != nil {
+		fail("rollup", "%v", err)
+	}
+	if err := routes.ValidateRetentionConfig(cfg.Retention.Routes()); err != nil {
+		fail("retention", "%v", err)
+	}
+	if err := routes.ValidatePartitionConfig(cfg.Partition.Routes()); err != nil {
+		fail("partitioning", "%v", err)
+	}
+
+	if err := routes.ValidateSQLConfig(cfg.SQL.Routes()); err != nil {
+		fail("sql", "%v", err)
+	}
+	if err := routes.ValidateAuthConfig(cfg.Auth.Routes()); err != nil {
+		fail("auth", "%v", err)
+	}
+	if err := routes.ValidateTablePermissions(cfg.Auth.TablePermissions); err != nil {
+		fail("auth.table_permissions", "%v", err)
+	}
+	if (cfg.Auth.Admin.Username == "") != (cfg.Auth.Admin.Password == "") {
+		fail("auth.admin", "username и password задаются только вместе")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Routes преобразует параметры агрегатов для пакета routes
+func (r RollupConfig) Routes() routes.RollupConfig {
+	return routes.RollupConfig{Enabled: r.Enabled, Interval: r.Interval, BatchSize: r.BatchSize}
+}
+
+// Routes преобразует правила хранения для пакета routes
+func (r RetentionConfig) Routes() routes.RetentionConfig {
+	cfg := routes.RetentionConfig{
+		Interval:   r.Interval,
+		BatchSize:  r.BatchSize,
+		DryRun:     r.DryRun,
+		ArchiveDir: r.ArchiveDir,
+	}
+	for _, rule := range r.Rules {
+		cfg.Rules = append(cfg.Rules, routes.RetentionRule{
+			Table:      rule.Table,
+			Circuit:    rule.Circuit,
+			TimeColumn: rule.TimeColumn,
+			Keep:       time.Duration(rule.Keep),
+			Archive:    rule.Archive,
+		})
+	}
+	return cfg
+}
+
+// Routes преобразует настройки секционирования для пакета routes
+func (p PartitionConfig) Routes() routes.PartitionConfig {
+	cfg := routes.PartitionConfig{CheckInterval: p.CheckInterval}
+	for _, t := range p.Tables {
+		cfg.Tables = append(cfg.Tables, routes.PartitionRule{
+			Table:   t.Table,
+			Column:  t.Column,
+			Period:  t.Period,
+			Premake: t.Premake,
+		})
+	}
+	return cfg
+}
+
+// Routes преобразует ограничения SQL для пакета routes
+func (s SQLConfig) Routes() routes.SQLConfig {
+	return routes.SQLConfig{
+		Tables:           s.Tables,
+		Functions:        s.Functions,
+		StatementTimeout: s.StatementTimeout,
+		MaxRows:          s.MaxRows,
+		Role:             s.Role,
+	}
+}
+
+// Routes преобразует параметры аутентификации для пакета routes
+func (a AuthConfig) Routes() routes.AuthConfig {
+	return routes.AuthConfig{
+		Secret:        []byte(a.JWTSecret),
+		AccessTTL:     a.AccessTTL,
+		RefreshTTL:    a.RefreshTTL,
+		AllowRegister: a.AllowRegister,
+	}
+}
+
+// Defaults преобразует параметры генерации для пакета routes
+func (g GeneratorConfig) Defaults() routes.GenerationDefaults {
+	return routes.GenerationDefaults{
+		Interval:    g.Interval,
+		Table:       g.Table,
+		CircuitID:   g.CircuitID,
+		SensorModel: g.SensorModel,
+	}
+}
+
+// Routes преобразует параметры потоковой передачи для пакета routes
+func (s StreamConfig) Routes() routes.StreamConfig {
+	return routes.StreamConfig{
+		SendQueueSize: s.SendQueueSize,
+		Overflow:      routes.OverflowPolicy(s.Overflow),
+		WriteTimeout:  s.WriteTimeout,
+		PongTimeout:   s.PongTimeout,
+	}
+}
+
+// Routes преобразует параметры записи измерений для пакета routes
+func (w WriterConfig) Routes() routes.WriterConfig {
+	return routes.WriterConfig{
+		BatchSize:     w.BatchSize,
+		FlushInterval: w.FlushInterval,
+		QueueSize:     w.QueueSize,
+		MaxRetries:    w.MaxRetries,
+		RetryBackoff:  w.RetryBackoff,
+	}
+}
+
+// TLS включен, если заданы сертификат и ключ
+func (s ServerConfig) TLS() bool {
+	return s.TLSCert != "" && s.TLSKey != ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,8 @@ package database
 import (
 	"fmt"
 	"log"
+	"strings"
+	"time"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -10,17 +12,27 @@ import (
 var DB *gorm.DB
 
 type Config struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+	SSLMode  string `yaml:"sslmode"` // disable, require, verify-ca, verify-full ...
+
+	// Пул соединений; 0 - значение драйвера по умолчанию
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
 }
 
 func InitDB(cfg Config) error {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
 	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName,
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, quoteDSN(cfg.Password), cfg.DBName, sslMode,
 	)
 
 	var err error
@@ -29,10 +41,31 @@ func InitDB(cfg Config) error {
 		return err
 	}
 
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+
 	log.Println("Успешное подключение к PostgreSQL с GORM!")
 	return nil
 }
 
+// Экранирует значение для строки подключения key=value
+func quoteDSN(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
 func CloseDB() {
     if DB != nil {
         sqlDB, _ := DB.DB()
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory-блокировки, чтобы миграции не выполнялись параллельно
+const migrationLockKey = 7_315_001
+
+// Миграция схемы: файлы migrations/<версия>_<имя>.up.sql и .down.sql
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Примененная версия схемы
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Состояние миграции для команды status
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool // применена в базе, но отсутствует в бинарнике
+}
+
+// Читает встроенные миграции, упорядоченные по версии
+func loadMigrations() ([]migration, error) {
+	paths, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, path := range paths {
+		base := strings.TrimPrefix(path, "migrations/")
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction, base = "up", strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			direction, base = "down", strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, fmt.Errorf("неверное имя файла миграции: %s", path)
+		}
+
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("неверное имя файла миграции: %s", path)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверная версия миграции %s: %w", path, err)
+		}
+
+		body, err := migrationFiles.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("у версии %d разные имена: %s и %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	result := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s нет пары up/down", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// Читает примененные версии, создавая таблицу учета при необходимости
+func appliedMigrations(db *gorm.DB) (map[int64]schemaMigration, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, fmt.Errorf("не удалось создать schema_migrations: %w", err)
+	}
+
+	var applied []schemaMigration
+	if err := db.Order("version").Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[int64]schemaMigration, len(applied))
+	for _, m := range applied {
+		result[m.Version] = m
+	}
+	return result, nil
+}
+
+// MigrationStatus возвращает состояние всех известных и примененных миграций
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []MigrationState
+	for _, m := range migrations {
+		a, ok := applied[m.Version]
+		result = append(result, MigrationState{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: a.AppliedAt,
+		})
+		delete(applied, m.Version)
+	}
+	for _, a := range applied {
+		result = append(result, MigrationState{
+			Version:   a.Version,
+			Name:      a.Name,
+			Applied:   true,
+			AppliedAt: a.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// CheckSchemaVersion возвращает ошибку, если в базе применены миграции,
+// о которых этот бинарник не знает (схема новее кода)
+func CheckSchemaVersion(db *gorm.DB) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		if s.Unknown {
+			return fmt.Errorf("схема БД новее приложения: применена неизвестная миграция %04d_%s", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// Migrate применяет все еще не примененные миграции, каждую в своей транзакции
+func Migrate(db *gorm.DB) error {
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := runLocked(db, func(tx *gorm.DB) error {
+			// Повторная проверка под блокировкой: миграцию мог применить другой экземпляр
+			var count int64
+			if err := tx.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("миграция %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Применена миграция %04d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// MigrateDown откатывает последние steps примененных миграций
+func MigrateDown(db *gorm.DB, steps int) error {
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		err := runLocked(db, func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("откат %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Откачена миграция %04d_%s", m.Version, m.Name)
+		steps--
+	}
+	return nil
+}
+
+// Выполняет функцию в транзакции под advisory-блокировкой миграций
+func runLocked(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
@@ -0,0 +1,7 @@
+-- Возврат measurement_time к строковому представлению RFC3339 (UTC).
+-- Таблица не удаляется: в ней могут быть данные, созданные до миграций.
+DROP INDEX IF EXISTS current_measurements_circuit_time_idx;
+
+ALTER TABLE current_measurements
+    ALTER COLUMN measurement_time TYPE text
+    USING to_char(measurement_time AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"');
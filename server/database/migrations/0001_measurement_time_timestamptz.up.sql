@@ -0,0 +1,31 @@
+-- measurement_time хранился строкой RFC3339; переводим в timestamptz на месте.
+-- На новой базе таблица создается сразу с типизированной колонкой.
+CREATE TABLE IF NOT EXISTS current_measurements (
+    id               bigserial PRIMARY KEY,
+    measurement_time timestamptz NOT NULL,
+    current_value    real,
+    voltage_value    real,
+    circuit_id       text,
+    sensor_model     text,
+    is_overload      boolean
+);
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM information_schema.columns
+        WHERE table_schema = 'public'
+          AND table_name = 'current_measurements'
+          AND column_name = 'measurement_time'
+          AND data_type IN ('text', 'character varying')
+    ) THEN
+        ALTER TABLE current_measurements
+            ALTER COLUMN measurement_time TYPE timestamptz
+            USING measurement_time::timestamptz;
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS current_measurements_circuit_time_idx
+    ON current_measurements (circuit_id, measurement_time);
@@ -0,0 +1,15 @@
+-- Ключи API устройств для записи измерений без входа пользователя.
+-- Хранится только SHA-256 ключа; prefix - открытая часть для поиска.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           bigserial PRIMARY KEY,
+    name         text        NOT NULL,
+    prefix       text        NOT NULL UNIQUE,
+    key_hash     text        NOT NULL,
+    tables       jsonb       NOT NULL DEFAULT '[]',
+    circuits     jsonb       NOT NULL DEFAULT '[]',
+    expires_at   timestamptz,
+    revoked_at   timestamptz,
+    last_used_at timestamptz,
+    created_by   bigint      REFERENCES users (id) ON DELETE SET NULL,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
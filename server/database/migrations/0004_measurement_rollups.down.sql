@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS rollup_state;
+DROP TABLE IF EXISTS measurement_rollups_15m;
+DROP TABLE IF EXISTS measurement_rollups_1m;
+DROP TABLE IF EXISTS measurement_rollups_1s;
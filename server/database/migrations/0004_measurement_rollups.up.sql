@@ -0,0 +1,32 @@
+-- Агрегаты current_measurements по интервалам 1 с, 1 мин и 15 мин
+-- для каждой цепи и канала (current, voltage). sum и sum_sq позволяют
+-- пересчитывать крупные интервалы из мелких без обращения к сырым строкам.
+CREATE TABLE IF NOT EXISTS measurement_rollups_1s (
+    bucket     timestamptz      NOT NULL,
+    circuit_id text             NOT NULL,
+    channel    text             NOT NULL,
+    count      bigint           NOT NULL,
+    min        double precision NOT NULL,
+    max        double precision NOT NULL,
+    avg        double precision NOT NULL,
+    rms        double precision NOT NULL,
+    sum        double precision NOT NULL,
+    sum_sq     double precision NOT NULL,
+    PRIMARY KEY (circuit_id, channel, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS measurement_rollups_1m (LIKE measurement_rollups_1s INCLUDING ALL);
+CREATE TABLE IF NOT EXISTS measurement_rollups_15m (LIKE measurement_rollups_1s INCLUDING ALL);
+
+CREATE INDEX IF NOT EXISTS measurement_rollups_1s_bucket_idx ON measurement_rollups_1s (bucket);
+CREATE INDEX IF NOT EXISTS measurement_rollups_1m_bucket_idx ON measurement_rollups_1m (bucket);
+CREATE INDEX IF NOT EXISTS measurement_rollups_15m_bucket_idx ON measurement_rollups_15m (bucket);
+
+-- Докуда обработаны сырые строки: last_id - наибольший учтенный id,
+-- max_time - наибольшее учтенное время измерения
+CREATE TABLE IF NOT EXISTS rollup_state (
+    source_table text        PRIMARY KEY,
+    last_id      bigint      NOT NULL DEFAULT 0,
+    max_time     timestamptz,
+    updated_at   timestamptz NOT NULL DEFAULT now()
+);
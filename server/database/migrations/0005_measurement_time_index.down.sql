@@ -0,0 +1 @@
+DROP INDEX IF EXISTS current_measurements_time_idx;
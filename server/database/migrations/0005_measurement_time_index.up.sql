@@ -0,0 +1,6 @@
+-- Индекс по времени для очистки по сроку хранения: правило без цепи
+-- выбирает строки по measurement_time < cutoff, и индекс (circuit_id,
+-- measurement_time) для него не подходит. На секционированной таблице
+-- индекс создается и на всех секциях.
+CREATE INDEX IF NOT EXISTS current_measurements_time_idx
+    ON current_measurements (measurement_time);
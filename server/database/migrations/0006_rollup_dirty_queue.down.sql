@@ -0,0 +1,17 @@
+DROP TRIGGER IF EXISTS current_measurements_rollup_update ON current_measurements;
+DROP TRIGGER IF EXISTS current_measurements_rollup_insert ON current_measurements;
+DROP FUNCTION IF EXISTS rollup_mark_dirty();
+
+-- Неучтенные интервалы пересчитываются заново с первой строки после
+-- наибольшего id, уже попавшего в агрегаты
+ALTER TABLE rollup_state ADD COLUMN IF NOT EXISTS last_id bigint NOT NULL DEFAULT 0;
+UPDATE rollup_state SET last_id = COALESCE((
+    SELECT min(m.id) - 1 FROM current_measurements m
+    JOIN rollup_dirty_buckets d
+        ON d.circuit_id = COALESCE(m.circuit_id, '')
+        AND m.measurement_time >= d.bucket
+        AND m.measurement_time < d.bucket + interval '1 second'
+), (SELECT max(id) FROM current_measurements), 0)
+WHERE source_table = 'current_measurements';
+
+DROP TABLE IF EXISTS rollup_dirty_buckets;
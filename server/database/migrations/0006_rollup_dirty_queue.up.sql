@@ -0,0 +1,57 @@
+-- Очередь интервалов 1 с, в которые попали новые или измененные строки
+-- current_measurements. Интервал ставится в очередь триггером в той же
+-- транзакции, что и строка, поэтому становится виден расчету агрегатов
+-- только вместе с ней. Водяной знак по id этого не гарантировал: строка
+-- с меньшим id могла зафиксироваться после того, как расчет прошел дальше.
+CREATE TABLE IF NOT EXISTS rollup_dirty_buckets (
+    bucket     timestamptz NOT NULL,
+    circuit_id text        NOT NULL,
+    marked_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (bucket, circuit_id)
+);
+
+-- Повторная отметка обновляет строку очереди, а не пропускается: так
+-- транзакция с новой строкой держит блокировку отметки до фиксации, и
+-- расчет не может забрать отметку и посчитать интервал без этой строки.
+CREATE OR REPLACE FUNCTION rollup_mark_dirty() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO rollup_dirty_buckets (bucket, circuit_id)
+    SELECT DISTINCT date_trunc('second', measurement_time), COALESCE(circuit_id, '')
+    FROM new_rows
+    ORDER BY 1, 2
+    ON CONFLICT (bucket, circuit_id) DO UPDATE SET marked_at = now();
+
+    IF TG_OP = 'UPDATE' THEN
+        INSERT INTO rollup_dirty_buckets (bucket, circuit_id)
+        SELECT DISTINCT date_trunc('second', measurement_time), COALESCE(circuit_id, '')
+        FROM old_rows
+        ORDER BY 1, 2
+        ON CONFLICT (bucket, circuit_id) DO UPDATE SET marked_at = now();
+    END IF;
+    RETURN NULL;
+END
+$$;
+
+-- Удаление строк агрегаты не меняет: агрегаты переживают сырые данные,
+-- удаленные по сроку хранения
+DROP TRIGGER IF EXISTS current_measurements_rollup_insert ON current_measurements;
+CREATE TRIGGER current_measurements_rollup_insert
+    AFTER INSERT ON current_measurements
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION rollup_mark_dirty();
+
+DROP TRIGGER IF EXISTS current_measurements_rollup_update ON current_measurements;
+CREATE TRIGGER current_measurements_rollup_update
+    AFTER UPDATE ON current_measurements
+    REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION rollup_mark_dirty();
+
+-- Строки, еще не учтенные по прежнему водяному знаку
+INSERT INTO rollup_dirty_buckets (bucket, circuit_id)
+SELECT DISTINCT date_trunc('second', measurement_time), COALESCE(circuit_id, '')
+FROM current_measurements
+WHERE id > COALESCE((SELECT last_id FROM rollup_state WHERE source_table = 'current_measurements'), 0)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE rollup_state DROP COLUMN IF EXISTS last_id;
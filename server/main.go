@@ -1,10 +1,16 @@
 package main
 
 import (
+    "EPS/config"
     "EPS/database"
+    "context"
     "fmt"
     "log"
+    "net/http"
+    "os"
+    "os/signal"
     "EPS/routes"
+    "syscall"
     "time"
 
     "github.com/gin-contrib/cors"
@@ -12,26 +18,92 @@ import (
 )
 
 func main() {
-    dbConfig := database.Config{
-        Host:     "localhost",
-        Port:     5432,
-        User:     "postgres",
-        Password: "antivzlom",
-        DBName:   "test",
+    // Конфигурация: файл (EPS_CONFIG или config.yaml) и переменные окружения EPS_*
+    cfg, err := config.Load()
+    if err != nil {
+        log.Fatalf("Ошибка конфигурации:\n%v", err)
     }
 
     // Инициализация БД
-    if err := database.InitDB(dbConfig); err != nil {
+    if err := database.InitDB(cfg.Database); err != nil {
         log.Fatalf("Ошибка подключения к БД: %v", err)
     }
     defer database.CloseDB()
 
+    // Подкоманда управления миграциями: EPS migrate up|down [N]|status
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := runMigrateCommand(os.Args[2:]); err != nil {
+            log.Fatalf("Ошибка миграции БД: %v", err)
+        }
+        return
+    }
+
+    // Применение миграций схемы; запуск невозможен, если схема новее приложения
+    if cfg.Server.AutoMigrate {
+        if err := database.Migrate(database.DB); err != nil {
+            log.Fatalf("Ошибка миграции БД: %v", err)
+        }
+    } else if err := database.CheckSchemaVersion(database.DB); err != nil {
+        log.Fatalf("Ошибка миграции БД: %v", err)
+    }
+
+    // Подкоманда перевода таблиц на секционирование: EPS partition convert [таблица...].
+    // Выполняется отдельно от запуска сервера, который только создает будущие секции.
+    if len(os.Args) > 1 && os.Args[1] == "partition" {
+        if err := runPartitionCommand(cfg, os.Args[2:]); err != nil {
+            log.Fatalf("Ошибка секционирования: %v", err)
+        }
+        return
+    }
+
+    // Параметры генерации, потоковой передачи и записи измерений
+    if err := routes.ConfigureGeneration(cfg.Generator.Defaults()); err != nil {
+        log.Fatalf("Ошибка конфигурации генерации: %v", err)
+    }
+    if err := routes.ConfigureStream(cfg.Stream.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации потоковой передачи: %v", err)
+    }
+    if err := routes.ConfigureWriter(cfg.Writer.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации записи измерений: %v", err)
+    }
+
+    // Секционирование таблиц измерений по времени
+    if err := routes.ConfigurePartitions(database.DB, cfg.Partition.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации секционирования: %v", err)
+    }
+
+    // Фоновый расчет агрегатов измерений
+    if err := routes.ConfigureRollups(database.DB, cfg.Rollup.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации агрегатов: %v", err)
+    }
+
+    // Очистка и архивирование устаревших данных
+    if err := routes.ConfigureRetention(database.DB, cfg.Retention.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации хранения: %v", err)
+    }
+
+    // Ограничения пользовательского SQL
+    if err := routes.ConfigureSQL(cfg.SQL.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации SQL: %v", err)
+    }
+
+    // Аутентификация и начальный администратор
+    if err := routes.ConfigureAuth(cfg.Auth.Routes()); err != nil {
+        log.Fatalf("Ошибка конфигурации аутентификации: %v", err)
+    }
+    if err := routes.ConfigureTablePermissions(cfg.Auth.TablePermissions); err != nil {
+        log.Fatalf("Ошибка конфигурации прав доступа: %v", err)
+    }
+    if err := routes.BootstrapAdmin(database.DB, cfg.Auth.Admin.Username, cfg.Auth.Admin.Password); err != nil {
+        log.Fatalf("Ошибка создания администратора: %v", err)
+    }
+
     // Настройка роутера
     r := gin.Default()
 
     // Настройка CORS - исправленная версия
     r.Use(cors.New(cors.Config{
-        AllowOrigins:     []string{"http://localhost:3000", "http://visualgraph.ru", "http://www.visualgraph.ru"},
+        AllowOrigins:     cfg.Server.CORSOrigins,
         AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
         AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With"},
         ExposeHeaders:    []string{"Content-Length", "Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"},
@@ -45,33 +117,128 @@ func main() {
         c.Next()
     })
 
-    // Группа маршрутов с префиксом /api
-    api := r.Group("/api")
+    // Выдача и обновление токенов - без аутентификации
+    auth := r.Group("/api/auth")
+    {
+        auth.POST("/register", routes.RegisterHandler)
+        auth.POST("/login", routes.LoginHandler)
+        auth.POST("/refresh", routes.RefreshHandler)
+        auth.POST("/logout", routes.LogoutHandler)
+    }
+
+    // Запись измерений устройствами по ключу API (Authorization: ApiKey ...)
+    ingest := r.Group("/api/ingest", routes.APIKeyMiddleware())
+    {
+        ingest.POST("/measurements", routes.IngestMeasurementsHandler)
+    }
+
+    // Группа маршрутов с префиксом /api, доступна только с access-токеном
+    api := r.Group("/api", routes.AuthMiddleware())
+
+    // Чтение: роль viewer и выше
+    read := api.Group("", routes.RequirePermission(routes.PermRead))
+    {
+        read.GET("/getparams", routes.GetDatabases)
+        read.GET("/metadata", routes.GetDatabaseMetadata)
+        read.POST("/execute-query", routes.HandleSQLQuery)
+        read.POST("/v2/execute-query", routes.ExecuteQueryV2Handler) // INSERT/UPDATE/DELETE дополнительно требуют edit_rows
+        read.POST("/downldata", routes.DownloadData)
+        read.GET("/series", routes.SeriesHandler)
+        read.GET("/tables/:tableName/rows", routes.ListRowsHandler)
+        read.GET("/tables/:tableName/rows/:pk", routes.GetRowHandler)
+
+        read.GET("/generation/status", routes.GenerationStatusHandler)
+        read.GET("/generation/sessions", routes.ListSessionsHandler)
+        read.GET("/generation/sessions/:id", routes.SessionStatusHandler)
+        read.GET("/replay", routes.ListReplaysHandler)
+        read.GET("/replay/:id", routes.ReplayStatusHandler)
+
+        // Потоковая передача данных графиков
+        read.GET("/ws", routes.WebSocketHandler)
+    }
+
+    // Версия 1 API данных: история, последние значения и метаданные таблиц
+    v1 := api.Group("/v1", routes.RequirePermission(routes.PermRead))
+    {
+        v1.GET("/data/latest", routes.GetLatestDataHandler)
+        v1.GET("/data/history", routes.GetDataHistoryHandler)
+        v1.GET("/tables", routes.GetTablesList)
+        v1.GET("/tables/:tableName", routes.GetTableMetadata)
+    }
+
+    // Генерация и воспроизведение: роль operator и выше
+    operate := api.Group("", routes.RequirePermission(routes.PermGenerate))
+    {
+        operate.POST("/generation/start", routes.StartGenerationHandler)
+        operate.POST("/generation/stop", routes.StopGenerationHandler)
+        operate.POST("/generation/sessions", routes.CreateSessionHandler)
+        operate.DELETE("/generation/sessions/:id", routes.DeleteSessionHandler)
+
+        operate.POST("/replay", routes.StartReplayHandler)
+        operate.POST("/replay/:id/:action", routes.ControlReplayHandler)
+        operate.DELETE("/replay/:id", routes.StopReplayHandler)
+    }
+
+    // Изменение строк: роль editor и выше
+    edit := api.Group("", routes.RequirePermission(routes.PermEditRows))
     {
-        api.GET("/getparams", routes.GetDatabases)
-        api.GET("/metadata", routes.GetDatabaseMetadata)    
-        api.POST("/execute-query", routes.HandleSQLQuery)
-        
-        // Эндпоинты для управления генерацией данных
-        api.POST("/generation/start", routes.StartGenerationHandler)
-        api.POST("/generation/stop", routes.StopGenerationHandler)
-        api.GET("/generation/status", routes.GenerationStatusHandler)
-
-        //Эндпоинты админки
-        api.POST("/deltable", routes.DeleteTable)
-        api.POST("/addrow", routes.AddRow)
-        api.POST("/delrow", routes.DeleteRow)
-        api.POST("/updaterow", routes.UpdateRow)
-        api.POST("/downldata", routes.DownloadData)
-        api.POST("/sqlquery", routes.SqlQuery)
+        edit.POST("/tables/:tableName/rows", routes.CreateRowHandler)
+        edit.PATCH("/tables/:tableName/rows/:pk", routes.UpdateRowHandler)
+        edit.DELETE("/tables/:tableName/rows/:pk", routes.DeleteRowHandler)
+    }
+
+    // Схема и пользователи: только admin
+    admin := api.Group("", routes.RequirePermission(routes.PermSchema))
+    {
+        admin.POST("/deltable", routes.DeleteTable)
+        admin.GET("/admin/users", routes.ListUsersHandler)
+        admin.PATCH("/admin/users/:id/role", routes.SetUserRoleHandler)
+
+        // Ключи API устройств
+        admin.POST("/admin/api-keys", routes.CreateAPIKeyHandler)
+        admin.GET("/admin/api-keys", routes.ListAPIKeysHandler)
+        admin.DELETE("/admin/api-keys/:id", routes.RevokeAPIKeyHandler)
+
+        // Сроки хранения данных
+        admin.GET("/admin/retention", routes.RetentionStatusHandler)
+        admin.POST("/admin/retention/run", routes.RunRetentionHandler)
     }
 
+    // Произвольный SQL: только admin
+    api.POST("/sqlquery", routes.RequirePermission(routes.PermRawSQL), routes.SqlQuery)
+
     // Выведите все зарегистрированные маршруты
     fmt.Println("Registered routes:")
     for _, route := range r.Routes() {
         fmt.Printf("%-6s %s\n", route.Method, route.Path)
     }
 
-    // Запуск сервера
-    r.Run(":8080")
+    // Запуск сервера; по SIGINT/SIGTERM - остановка с дозаписью измерений
+    srv := &http.Server{Addr: cfg.Server.Listen, Handler: r}
+    serverErr := make(chan error, 1)
+    go func() {
+        if cfg.Server.TLS() {
+            serverErr <- srv.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey)
+        } else {
+            serverErr <- srv.ListenAndServe()
+        }
+    }()
+
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+    select {
+    case err := <-serverErr:
+        log.Fatalf("Ошибка запуска сервера: %v", err)
+    case <-ctx.Done():
+    }
+
+    log.Println("Остановка сервера...")
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    if err := srv.Shutdown(shutdownCtx); err != nil {
+        log.Printf("Ошибка остановки HTTP сервера: %v", err)
+    }
+    if err := routes.ShutdownWriter(shutdownCtx); err != nil {
+        log.Printf("Ошибка дозаписи измерений: %v", err)
+    }
 }
\ No newline at end of file
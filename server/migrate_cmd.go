@@ -0,0 +1,50 @@
+package main
+
+import (
+    "EPS/database"
+    "fmt"
+    "os"
+    "strconv"
+)
+
+// Подкоманда migrate up|down [N]|status
+func runMigrateCommand(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("использование: migrate up|down [N]|status")
+    }
+
+    switch args[0] {
+    case "up":
+        return database.Migrate(database.DB)
+
+    case "down":
+        steps := 1
+        if len(args) > 1 {
+            n, err := strconv.Atoi(args[1])
+            if err != nil || n <= 0 {
+                return fmt.Errorf("число шагов отката должно быть положительным: %q", args[1])
+            }
+            steps = n
+        }
+        return database.MigrateDown(database.DB, steps)
+
+    case "status":
+        states, err := database.MigrationStatus(database.DB)
+        if err != nil {
+            return err
+        }
+        for _, s := range states {
+            status := "pending"
+            if s.Applied {
+                status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+            }
+            if s.Unknown {
+                status += " (неизвестна приложению)"
+            }
+            fmt.Fprintf(os.Stdout, "%04d  %-40s %s\n", s.Version, s.Name, status)
+        }
+        return nil
+    }
+
+    return fmt.Errorf("неизвестная команда migrate: %q", args[0])
+}
@@ -1,11 +1,52 @@
 package models
 
+import "time"
+
 type Current_measurements struct {
-	ID               uint   `gorm:"primaryKey"`
-	Measurement_time string `gorm:"not null"`
+	ID               uint      `gorm:"primaryKey"`
+	Measurement_time time.Time `gorm:"type:timestamptz;not null"`
 	Current_value    float32
 	Voltage_value    float32
 	Circuit_id       string
 	Sensor_model     string
 	Is_overload      bool
 }
+
+// Пользователь приложения
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"uniqueIndex;not null" json:"username"`
+	PasswordHash string    `gorm:"not null" json:"-"` // bcrypt
+	Role         string    `gorm:"not null;default:viewer" json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Выданный refresh-токен; отозванный или удаленный токен нельзя обменять
+type RefreshToken struct {
+	ID        string    `gorm:"primaryKey"` // jti токена
+	UserID    uint      `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Ключ API устройства. Ключ только на запись измерений
+// в разрешенные таблицы и цепи.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"uniqueIndex;not null" json:"prefix"` // открытая часть ключа
+	KeyHash    string     `gorm:"not null" json:"-"`                  // SHA-256 ключа, hex
+	Tables     []string   `gorm:"type:jsonb;serializer:json" json:"tables"`
+	Circuits   []string   `gorm:"type:jsonb;serializer:json" json:"circuits"` // пусто - любые цепи
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedBy  *uint      `json:"createdBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
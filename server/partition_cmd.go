@@ -0,0 +1,34 @@
+package main
+
+import (
+    "EPS/config"
+    "EPS/database"
+    "EPS/routes"
+    "fmt"
+)
+
+// Подкоманда partition convert [таблица...]: переводит таблицы из
+// partitioning.tables на секционирование; без аргументов - все таблицы
+func runPartitionCommand(cfg config.Config, args []string) error {
+    if len(args) == 0 || args[0] != "convert" {
+        return fmt.Errorf("использование: partition convert [таблица...]")
+    }
+
+    partCfg := cfg.Partition.Routes()
+    tables := args[1:]
+    if len(tables) == 0 {
+        for _, rule := range partCfg.Tables {
+            tables = append(tables, rule.Table)
+        }
+    }
+    if len(tables) == 0 {
+        return fmt.Errorf("в partitioning.tables нет таблиц")
+    }
+
+    for _, table := range tables {
+        if err := routes.ConvertPartitioned(database.DB, partCfg, table); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,281 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"EPS/database"
+	"EPS/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Ключ имеет вид eps_<prefix>_<secret>: prefix ищется в БД, secret проверяется по хэшу
+const apiKeyScheme = "eps"
+
+// Ключ контекста gin с ключом API, который выставляет APIKeyMiddleware
+const ctxAPIKey = "apiKey"
+
+// Максимум строк в одном запросе записи
+const maxIngestRows = 10000
+
+// Обновлять last_used_at не чаще этого интервала
+const apiKeyTouchInterval = time.Minute
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Генерирует новый ключ и его открытую часть
+func newAPIKey() (key, prefix string) {
+	p := make([]byte, 6)
+	s := make([]byte, 24)
+	rand.Read(p)
+	rand.Read(s)
+	prefix = hex.EncodeToString(p)
+	return apiKeyScheme + "_" + prefix + "_" + hex.EncodeToString(s), prefix
+}
+
+// Разрешена ли запись в таблицу и цепь
+func apiKeyAllows(key *models.APIKey, table, circuit string) bool {
+	if !containsString(key.Tables, table) {
+		return false
+	}
+	return circuit == "" || len(key.Circuits) == 0 || containsString(key.Circuits, circuit)
+}
+
+// Находит действующий ключ; ошибка не раскрывает, какая проверка не прошла
+func lookupAPIKey(db *gorm.DB, raw string) (*models.APIKey, error) {
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != apiKeyScheme {
+		return nil, errInvalidAPIKey
+	}
+
+	var key models.APIKey
+	err := db.Where("prefix = ?", parts[1]).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashAPIKey(raw))) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, errInvalidAPIKey
+	}
+	return &key, nil
+}
+
+var errInvalidAPIKey = errors.New("недействительный ключ API")
+
+// APIKeyMiddleware требует заголовок Authorization: ApiKey <ключ>.
+// Используется только на маршрутах записи: ключ не дает прав на чтение.
+func APIKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "ApiKey ")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется ключ API"})
+			return
+		}
+
+		key, err := lookupAPIKey(database.DB, strings.TrimSpace(raw))
+		if errors.Is(err, errInvalidAPIKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный ключ API"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки ключа API"})
+			return
+		}
+
+		if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+			err := database.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).
+				Update("last_used_at", time.Now()).Error
+			if err != nil {
+				log.Printf("Не удалось обновить last_used_at ключа %s: %v", key.Prefix, err)
+			}
+		}
+
+		c.Set(ctxAPIKey, key)
+		c.Next()
+	}
+}
+
+// Измерение в запросе записи
+type ingestMeasurement struct {
+	MeasurementTime time.Time `json:"measurement_time" binding:"required"`
+	CurrentValue    float64   `json:"current_value"`
+	VoltageValue    float64   `json:"voltage_value"`
+	CircuitID       string    `json:"circuit_id" binding:"required"`
+	SensorModel     string    `json:"sensor_model"`
+	IsOverload      bool      `json:"is_overload"`
+}
+
+// IngestMeasurementsHandler принимает измерения от устройства и ставит их
+// в очередь асинхронной записи
+func IngestMeasurementsHandler(c *gin.Context) {
+	key := c.MustGet(ctxAPIKey).(*models.APIKey)
+
+	var req struct {
+		Table        string              `json:"table"`
+		Measurements []ingestMeasurement `json:"measurements" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Table == "" {
+		req.Table = generationDefaults.Table
+	}
+	if len(req.Measurements) == 0 || len(req.Measurements) > maxIngestRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Ожидается от 1 до %d измерений", maxIngestRows)})
+		return
+	}
+
+	if !apiKeyAllows(key, req.Table, "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Ключ не дает права записи в таблицу", "code": "forbidden", "table": req.Table})
+		return
+	}
+	for i, m := range req.Measurements {
+		if !apiKeyAllows(key, req.Table, m.CircuitID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Ключ не дает права записи для цепи",
+				"code":    "forbidden",
+				"circuit": m.CircuitID,
+				"index":   i,
+			})
+			return
+		}
+	}
+
+	tables, err := getTables(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить таблицу"})
+		return
+	}
+	if !containsString(tables, req.Table) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Таблица не найдена: " + req.Table})
+		return
+	}
+
+	rows := make([]CurrentMeasurement, len(req.Measurements))
+	for i, m := range req.Measurements {
+		rows[i] = CurrentMeasurement{
+			MeasurementTime: m.MeasurementTime.UTC(),
+			CurrentValue:    m.CurrentValue,
+			VoltageValue:    m.VoltageValue,
+			CircuitID:       m.CircuitID,
+			SensorModel:     m.SensorModel,
+			IsOverload:      m.IsOverload,
+		}
+	}
+	// Непринятые строки - всегда хвост запроса: клиент повторяет measurements[accepted:]
+	dropped := writer.enqueue(req.Table, rows)
+	if dropped > 0 {
+		c.Header("Retry-After", strconv.Itoa(writer.retryAfterSeconds()))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":    "Очередь записи переполнена",
+			"code":     "queue_full",
+			"accepted": len(rows) - dropped,
+			"dropped":  dropped,
+			"table":    req.Table,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"accepted": len(rows),
+		"table":    req.Table,
+	})
+}
+
+// CreateAPIKeyHandler создает ключ устройства. Ключ возвращается только в этом ответе.
+func CreateAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name" binding:"required"`
+		Tables    []string   `json:"tables" binding:"required,min=1"`
+		Circuits  []string   `json:"circuits"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, t := range req.Tables {
+		if !identifierPattern.MatchString(t) || containsString(serviceTables, t) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Недопустимая таблица: " + t})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt должен быть в будущем"})
+		return
+	}
+
+	raw, prefix := newAPIKey()
+	userID := c.GetUint(ctxUserID)
+	key := models.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hashAPIKey(raw),
+		Tables:    req.Tables,
+		Circuits:  req.Circuits,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: &userID,
+	}
+	if key.Circuits == nil {
+		key.Circuits = []string{}
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать ключ"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"apiKey": key, "key": raw})
+}
+
+// ListAPIKeysHandler возвращает ключи без секретной части
+func ListAPIKeysHandler(c *gin.Context) {
+	var keys []models.APIKey
+	if err := database.DB.Order("id").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить ключи"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys, "count": len(keys)})
+}
+
+// RevokeAPIKeyHandler отзывает ключ; запись остается для аудита
+func RevokeAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID ключа"})
+		return
+	}
+
+	res := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать ключ"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ключ не найден или уже отозван"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "status": "revoked"})
+}
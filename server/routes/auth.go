@@ -0,0 +1,395 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"EPS/database"
+	"EPS/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Типы токенов
+const (
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+)
+
+// Ключи контекста gin, которые выставляет AuthMiddleware
+const (
+	ctxUserID   = "userID"
+	ctxUserRole = "userRole"
+)
+
+const minPasswordLength = 8
+
+// Роль берется из access-токена без обращения к БД, поэтому смена роли
+// вступает в силу не позже, чем через время жизни access-токена
+const maxAccessTTL = time.Hour
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,64}$`)
+
+// Настройки аутентификации
+type AuthConfig struct {
+	Secret        []byte        // ключ подписи JWT (HS256)
+	AccessTTL     time.Duration // время жизни access-токена
+	RefreshTTL    time.Duration // время жизни refresh-токена
+	AllowRegister bool          // открытая регистрация новых пользователей (роль viewer)
+}
+
+// ValidateAuthConfig проверяет настройки аутентификации
+func ValidateAuthConfig(cfg AuthConfig) error {
+	if len(cfg.Secret) < 32 {
+		return fmt.Errorf("ключ подписи JWT должен быть не короче 32 байт")
+	}
+	if cfg.AccessTTL <= 0 || cfg.RefreshTTL <= 0 {
+		return fmt.Errorf("время жизни токенов должно быть положительным")
+	}
+	if cfg.AccessTTL > maxAccessTTL {
+		return fmt.Errorf("время жизни access-токена не должно превышать %s", maxAccessTTL)
+	}
+	if cfg.RefreshTTL < cfg.AccessTTL {
+		return fmt.Errorf("refresh-токен не может жить меньше access-токена")
+	}
+	return nil
+}
+
+var authConfig AuthConfig
+
+// ConfigureAuth задает настройки аутентификации.
+// Без вызова все запросы к /api отклоняются.
+func ConfigureAuth(cfg AuthConfig) error {
+	if err := ValidateAuthConfig(cfg); err != nil {
+		return err
+	}
+	authConfig = cfg
+	return nil
+}
+
+// Утверждения JWT
+type tokenClaims struct {
+	Type string `json:"typ"`
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Пара токенов в ответе
+type tokenPair struct {
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	TokenType        string    `json:"tokenType"`
+	AccessExpiresAt  time.Time `json:"accessExpiresAt"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// Учетные данные в запросах register и login
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Хэш для сравнения, когда пользователь не найден, чтобы время ответа
+// не выдавало существование логина
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func validateCredentials(cr credentials) error {
+	if !usernamePattern.MatchString(cr.Username) {
+		return fmt.Errorf("имя пользователя: 3-64 символа, латиница, цифры, _ . -")
+	}
+	if len(cr.Password) < minPasswordLength {
+		return fmt.Errorf("пароль должен быть не короче %d символов", minPasswordLength)
+	}
+	if len(cr.Password) > 72 {
+		return fmt.Errorf("пароль должен быть не длиннее 72 байт")
+	}
+	return nil
+}
+
+func newTokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func signToken(user models.User, typ string, id string, expires time.Time) (string, error) {
+	claims := tokenClaims{
+		Type: typ,
+		Role: user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprint(user.ID),
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(authConfig.Secret)
+}
+
+// Проверяет подпись, срок и тип токена
+func parseToken(raw, typ string) (*tokenClaims, error) {
+	if len(authConfig.Secret) == 0 {
+		return nil, fmt.Errorf("аутентификация не настроена")
+	}
+
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(*jwt.Token) (any, error) {
+		return authConfig.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != typ {
+		return nil, fmt.Errorf("неверный тип токена")
+	}
+	return claims, nil
+}
+
+// Выдает access- и refresh-токены; refresh-токен регистрируется в БД
+func issueTokens(db *gorm.DB, user models.User) (tokenPair, error) {
+	now := time.Now()
+	pair := tokenPair{
+		TokenType:        "Bearer",
+		AccessExpiresAt:  now.Add(authConfig.AccessTTL),
+		RefreshExpiresAt: now.Add(authConfig.RefreshTTL),
+	}
+
+	var err error
+	if pair.AccessToken, err = signToken(user, tokenAccess, newTokenID(), pair.AccessExpiresAt); err != nil {
+		return pair, err
+	}
+
+	refreshID := newTokenID()
+	if pair.RefreshToken, err = signToken(user, tokenRefresh, refreshID, pair.RefreshExpiresAt); err != nil {
+		return pair, err
+	}
+	err = db.Create(&models.RefreshToken{ID: refreshID, UserID: user.ID, ExpiresAt: pair.RefreshExpiresAt}).Error
+	return pair, err
+}
+
+// RegisterHandler создает пользователя с ролью viewer
+func RegisterHandler(c *gin.Context) {
+	if !authConfig.AllowRegister {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Регистрация отключена"})
+		return
+	}
+
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCredentials(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := createUser(database.DB, req.Username, req.Password, RoleViewer)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь уже существует"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать пользователя"})
+		return
+	}
+
+	pair, err := issueTokens(database.DB, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выдать токены"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"user": user, "tokens": pair})
+}
+
+// LoginHandler проверяет пароль и выдает пару токенов
+func LoginHandler(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	err := database.DB.Where("username = ?", req.Username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка чтения пользователя"})
+		return
+	}
+
+	hash := []byte(user.PasswordHash)
+	if err != nil {
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверное имя пользователя или пароль"})
+		return
+	}
+
+	pair, err := issueTokens(database.DB, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выдать токены"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "tokens": pair})
+}
+
+// RefreshHandler обменивает refresh-токен на новую пару; старый токен отзывается
+func RefreshHandler(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := parseToken(req.RefreshToken, tokenRefresh)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный refresh-токен"})
+		return
+	}
+
+	var pair tokenPair
+	var user models.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Отзыв по условию revoked_at IS NULL: повторный обмен того же токена не пройдет
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > now()", claims.ID).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errTokenRevoked
+		}
+		// Роль и существование пользователя читаются заново: новая пара
+		// получает текущую роль, а удаленный пользователь токены не получит
+		if err := tx.First(&user, "id = ?", claims.Subject).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, err = issueTokens(tx, user)
+		return err
+	})
+	if errors.Is(err, errTokenRevoked) || errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный refresh-токен"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось выдать токены"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "tokens": pair})
+}
+
+var errTokenRevoked = errors.New("токен отозван")
+
+// LogoutHandler отзывает refresh-токен
+func LogoutHandler(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := parseToken(req.RefreshToken, tokenRefresh)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный refresh-токен"})
+		return
+	}
+
+	err = database.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", claims.ID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать токен"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "logged out"})
+}
+
+// AuthMiddleware требует действительный access-токен в заголовке
+// Authorization: Bearer и кладет userID и userRole в контекст.
+// Браузер не может задать заголовок для WebSocket, поэтому при
+// upgrade-запросе токен принимается и из параметра access_token.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok && strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			raw, ok = c.Query("access_token"), c.Query("access_token") != ""
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется аутентификация"})
+			return
+		}
+
+		claims, err := parseToken(strings.TrimSpace(raw), tokenAccess)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+			return
+		}
+
+		var userID uint
+		if _, err := fmt.Sscan(claims.Subject, &userID); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+			return
+		}
+
+		c.Set(ctxUserID, userID)
+		c.Set(ctxUserRole, claims.Role)
+		c.Next()
+	}
+}
+
+func createUser(db *gorm.DB, username, password, role string) (models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{Username: username, PasswordHash: string(hash), Role: role}
+	err = db.Create(&user).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		err = gorm.ErrDuplicatedKey
+	}
+	return user, err
+}
+
+// BootstrapAdmin создает администратора из конфигурации, если пользователя
+// с таким именем еще нет. Существующая учетная запись не меняется.
+func BootstrapAdmin(db *gorm.DB, username, password string) error {
+	if username == "" {
+		return nil
+	}
+	if err := validateCredentials(credentials{username, password}); err != nil {
+		return fmt.Errorf("администратор %s: %w", username, err)
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := createUser(db, username, password, RoleAdmin); err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return err
+	}
+	log.Printf("Создан администратор %s", username)
+	return nil
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"time"
+)
+
+// Ограничения параметров пакетирования, задаваемых клиентом
+const (
+	maxBatchWindowMs   = 5000
+	maxBatchSamples    = 10000
+	defaultBatchWindow = 250 * time.Millisecond
+)
+
+// Накапливаемый для клиента пакет данных одного графика
+type pendingBatch struct {
+	data  []ChartData
+	timer *time.Timer
+}
+
+// Передача данных клиенту: сразу или через пакет графика.
+// batchMu не удерживается во время enqueue, чтобы не пересекаться с queueMu.
+func (cl *wsClient) deliver(data ChartData, window time.Duration, maxSamples int) {
+	if window <= 0 && maxSamples <= 0 {
+		cl.enqueue(data)
+		return
+	}
+
+	cl.batchMu.Lock()
+	b, ok := cl.batches[data.ChartID]
+	if !ok {
+		b = &pendingBatch{}
+		cl.batches[data.ChartID] = b
+		chartID, batch := data.ChartID, b
+		b.timer = time.AfterFunc(window, func() { cl.flushBatch(chartID, batch) })
+	}
+	b.data = append(b.data, data)
+
+	var ready []ChartData
+	if maxSamples > 0 && len(b.data) >= maxSamples {
+		b.timer.Stop()
+		delete(cl.batches, data.ChartID)
+		ready = b.data
+	}
+	cl.batchMu.Unlock()
+
+	if ready != nil {
+		cl.enqueue(&ChartDataBatch{Type: "batch", ChartID: data.ChartID, Data: ready})
+	}
+}
+
+// Отправка накопленного пакета графика по истечении окна
+func (cl *wsClient) flushBatch(chartID string, b *pendingBatch) {
+	cl.batchMu.Lock()
+	// Пакет мог уже уйти досрочно по maxSamples
+	ok := cl.batches[chartID] == b
+	if ok {
+		delete(cl.batches, chartID)
+	}
+	cl.batchMu.Unlock()
+
+	if ok && len(b.data) > 0 {
+		cl.enqueue(&ChartDataBatch{Type: "batch", ChartID: chartID, Data: b.data})
+	}
+}
+
+// Останавливает таймеры всех пакетов при отключении клиента
+func (cl *wsClient) stopBatches() {
+	cl.batchMu.Lock()
+	defer cl.batchMu.Unlock()
+
+	for chartID, b := range cl.batches {
+		b.timer.Stop()
+		delete(cl.batches, chartID)
+	}
+}
@@ -3,8 +3,12 @@ package routes
 import (
 	"EPS/database"
 	"EPS/models"
+	"EPS/sqlguard"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,7 +26,7 @@ func GetDatabases(c *gin.Context) {
 	// Формируем ответ с дополнительной информацией
 	type Measurements struct {
 		ID               uint
-		Measurement_time string
+		Measurement_time time.Time
 		Current_value    float32
 		Voltage_value    float32
 		Circuit_id       string
@@ -60,31 +64,122 @@ func HandleSQLQuery(c *gin.Context) {
 		return
 	}
 
-	// Проверяем, что запрос не пустой
-	if request.Query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "SQL query is required"})
+	// Только один SELECT по доступным таблицам
+	if _, ok := checkSQL(c, request.Query, PermRead, sqlguard.Select); !ok {
 		return
 	}
 
-	// Ограничиваем только SELECT запросы для безопасности
-	trimmedQuery := strings.TrimSpace(request.Query)
-	if !strings.HasPrefix(strings.ToUpper(trimmedQuery), "SELECT") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only SELECT queries are allowed"})
+	// Выполняем в транзакции только для чтения с ограничением времени и строк
+	result, err := runReadOnlyQuery(c.Request.Context(), request.Query)
+	if err != nil {
+		respondQueryError(c, err)
 		return
 	}
 
-	// Выполняем SQL запрос и получаем результат в виде map
-	var results []map[string]interface{}
-	err := database.DB.Raw(request.Query).Scan(&results).Error
+	// Возвращаем результаты
+	c.JSON(http.StatusOK, gin.H{
+		"data": result.Rows,
+		"columns": result.Columns,
+		"count": len(result.Rows),
+		"truncated": result.Truncated,
+	})
+
+}
+
+// Максимум параметров в одном запросе (ограничение протокола PostgreSQL)
+const maxQueryParams = 65535
+
+// ExecuteQueryV2Handler выполняет запрос {sql, params} с плейсхолдерами $1..$n.
+// Значения передаются только через params и связываются pgx на сервере БД;
+// строковые и числовые константы в тексте запроса отклоняются.
+// SELECT выполняется только на чтение, INSERT/UPDATE/DELETE требуют права edit_rows.
+func ExecuteQueryV2Handler(c *gin.Context) {
+	var request struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный JSON: " + err.Error()})
+		return
+	}
+	if len(request.Params) > maxQueryParams {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Не больше %d параметров", maxQueryParams)})
+		return
+	}
+
+	stmt, ok := checkSQLPolicy(c, request.SQL, PermEditRows, sqlguard.Policy{
+		Kinds:         []sqlguard.Kind{sqlguard.Select, sqlguard.Insert, sqlguard.Update, sqlguard.Delete},
+		RequireParams: true,
+	})
+	if !ok {
+		return
+	}
+	if stmt.Params != len(request.Params) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    fmt.Sprintf("Запрос ожидает %d параметров, передано %d", stmt.Params, len(request.Params)),
+			"expected": stmt.Params,
+		})
+		return
+	}
+
+	args := make([]interface{}, len(request.Params))
+	for i, p := range request.Params {
+		v, err := queryParam(p)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Параметр $%d: %v", i+1, err)})
+			return
+		}
+		args[i] = v
+	}
+
+	result, err := runQuery(c.Request.Context(), stmt.Kind == sqlguard.Select, request.SQL, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute query: " + err.Error()})
+		respondQueryError(c, err)
 		return
 	}
 
-	// Возвращаем результаты
+	columns := make([]gin.H, len(result.Columns))
+	for i, name := range result.Columns {
+		columns[i] = gin.H{"name": name, "type": result.Types[i]}
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"data": results,
-		"count": len(results),
+		"type":          strings.ToLower(string(stmt.Kind)),
+		"columns":       columns,
+		"data":          result.Rows,
+		"count":         len(result.Rows),
+		"rows_affected": result.RowsAffected,
+		"truncated":     result.Truncated,
 	})
+}
 
+// Приводит параметр из JSON к значению для pgx: целые числа - int64,
+// дробные - float64, массивы - поэлементно. Объекты не допускаются.
+func queryParam(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case nil, string, bool:
+		return val, nil
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n, nil
+		}
+		return val.Float64()
+	case []interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			if _, nested := item.([]interface{}); nested {
+				return nil, fmt.Errorf("вложенные массивы не поддерживаются")
+			}
+			converted, err := queryParam(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("недопустимый тип значения %T", v)
+	}
 }
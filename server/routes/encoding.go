@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Подпротоколы WebSocket, определяющие формат кадров данных.
+// Схема бинарного формата - proto/stream.proto.
+const (
+	subprotocolJSON     = "eps.json"
+	subprotocolProtobuf = "eps.protobuf"
+)
+
+// Номера полей из proto/stream.proto
+const (
+	frameChartIDField    protowire.Number = 1
+	frameBaseTimeField   protowire.Number = 2
+	frameChannelsField   protowire.Number = 3
+	channelTypeField     protowire.Number = 1
+	channelDeltasField   protowire.Number = 2
+	channelValuesField   protowire.Number = 3
+	channelOverloadField protowire.Number = 4
+)
+
+// Кодирование сообщения для отправки клиенту
+func (cl *wsClient) encode(msg interface{}) (int, []byte, error) {
+	if cl.conn.Subprotocol() == subprotocolProtobuf {
+		switch m := msg.(type) {
+		case ChartData:
+			return websocket.BinaryMessage, encodeChartFrame(m.ChartID, []ChartData{m}), nil
+		case *ChartDataBatch:
+			return websocket.BinaryMessage, encodeChartFrame(m.ChartID, m.Data), nil
+		}
+	}
+
+	// JSON по умолчанию и для управляющих ответов
+	b, err := json.Marshal(msg)
+	return websocket.TextMessage, b, err
+}
+
+// Кодирует отсчеты графика в ChartFrame с колонками по типам сигналов
+func encodeChartFrame(chartID string, data []ChartData) []byte {
+	var frame []byte
+	if len(data) == 0 {
+		return frame
+	}
+
+	base := data[0].Timestamp.UnixMicro()
+	for _, d := range data[1:] {
+		if t := d.Timestamp.UnixMicro(); t < base {
+			base = t
+		}
+	}
+
+	if chartID != "" {
+		frame = protowire.AppendTag(frame, frameChartIDField, protowire.BytesType)
+		frame = protowire.AppendString(frame, chartID)
+	}
+	frame = protowire.AppendTag(frame, frameBaseTimeField, protowire.VarintType)
+	frame = protowire.AppendVarint(frame, uint64(base))
+
+	// Группируем отсчеты по типу, сохраняя порядок появления типов
+	var order []string
+	channels := make(map[string][]ChartData)
+	for _, d := range data {
+		if _, ok := channels[d.Type]; !ok {
+			order = append(order, d.Type)
+		}
+		channels[d.Type] = append(channels[d.Type], d)
+	}
+
+	for _, t := range order {
+		frame = protowire.AppendTag(frame, frameChannelsField, protowire.BytesType)
+		frame = protowire.AppendBytes(frame, encodeChannel(t, base, channels[t]))
+	}
+	return frame
+}
+
+func encodeChannel(signalType string, base int64, samples []ChartData) []byte {
+	var ch []byte
+	ch = protowire.AppendTag(ch, channelTypeField, protowire.BytesType)
+	ch = protowire.AppendString(ch, signalType)
+
+	var deltas, values, overload []byte
+	hasOverload := false
+	prev := base
+	for _, s := range samples {
+		t := s.Timestamp.UnixMicro()
+		deltas = protowire.AppendVarint(deltas, protowire.EncodeZigZag(t-prev))
+		prev = t
+
+		values = protowire.AppendFixed32(values, math.Float32bits(float32(s.Value)))
+
+		overload = protowire.AppendVarint(overload, protowire.EncodeBool(s.Overload))
+		hasOverload = hasOverload || s.Overload
+	}
+
+	ch = protowire.AppendTag(ch, channelDeltasField, protowire.BytesType)
+	ch = protowire.AppendBytes(ch, deltas)
+	ch = protowire.AppendTag(ch, channelValuesField, protowire.BytesType)
+	ch = protowire.AppendBytes(ch, values)
+	if hasOverload {
+		ch = protowire.AppendTag(ch, channelOverloadField, protowire.BytesType)
+		ch = protowire.AppendBytes(ch, overload)
+	}
+	return ch
+}
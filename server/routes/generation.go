@@ -1,32 +1,16 @@
 package routes
 
 import (
+	"errors"
+	"io"
 	"log"
-	"math"
 	"net/http"
-	"sync"
 	"time"
 
-	"EPS/database"
-
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"gorm.io/gorm"
 )
 
-var (
-	generationMutex sync.Mutex
-	isGenerating    bool
-	stopGeneration  chan bool
-	clients         = make(map[*websocket.Conn]bool)
-	broadcast       = make(chan ChartData)
-	upgrader        = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
-	}
-)
-
 // Структуры данных
 type GenerationStatus struct {
 	IsGenerating bool   `json:"isGenerating"`
@@ -46,7 +30,7 @@ type ChartData struct {
 
 // Структура для пакетной отправки данных
 type ChartDataBatch struct {
-	Type    string      `json:"type"`
+	Type    string      `json:"type"` // "batch"
 	Data    []ChartData `json:"data"`
 	ChartID string      `json:"chartId,omitempty"`
 }
@@ -62,144 +46,82 @@ type CurrentMeasurement struct {
 	IsOverload      bool      `json:"is_overload"`
 }
 
-// WebSocketHandler для подключения клиентов
-func WebSocketHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+// StartGenerationHandler запускает генерацию данных.
+// Совместимый вариант POST /generation/sessions: ID сессии - chartId или "default".
+func StartGenerationHandler(c *gin.Context) {
+	// Получаем настройки из запроса
+	var request SessionConfig
+	// Пустое тело - настройки по умолчанию
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer conn.Close()
-
-	clients[conn] = true
-	log.Printf("WebSocket client connected. Total clients: %d", len(clients))
-
-	// Обработка сообщений от клиента
-	for {
-		messageType, p, err := conn.ReadMessage()
-		if err != nil {
-			delete(clients, conn)
-			log.Printf("WebSocket client disconnected. Total clients: %d", len(clients))
-			break
-		}
-
-		// Эхо-ответ для тестирования
-		if err := conn.WriteMessage(messageType, p); err != nil {
-			log.Printf("WebSocket write error: %v", err)
-			break
-		}
-	}
-}
 
-// Broadcast data to all connected clients
-func broadcastData() {
-	for {
-		data := <-broadcast
-		for client := range clients {
-			err := client.WriteJSON(data)
-			if err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
-		}
+	if request.ID == "" && request.ChartID == "" {
+		request.ID = defaultSessionID
 	}
-}
 
-// Запускаем broadcast горутину
-func init() {
-	go broadcastData()
+	startSession(c, request)
 }
 
-// StartGenerationHandler запускает генерацию данных
-func StartGenerationHandler(c *gin.Context) {
-	generationMutex.Lock()
-	defer generationMutex.Unlock()
-
-	if isGenerating {
-		c.JSON(http.StatusConflict, gin.H{
-			"error": "Генерация уже запущена",
-		})
-		return
-	}
-
-	// Проверяем доступность БД
-	if database.DB == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Подключение к БД не инициализировано",
-		})
-		return
-	}
-
-	// Получаем настройки из запроса
+// StopGenerationHandler останавливает генерацию данных
+func StopGenerationHandler(c *gin.Context) {
 	var request struct {
-		Interval int    `json:"interval"` // интервал в мс
-		ChartID  string `json:"chartId"`  // ID графика (опционально)
+		ID      string `json:"id"`
+		ChartID string `json:"chartId"`
 	}
+	c.ShouldBindJSON(&request)
 
-	if err := c.BindJSON(&request); err != nil {
-		request.Interval = 20 // по умолчанию 20мс
+	id := request.ID
+	if id == "" {
+		id = request.ChartID
+	}
+	if id == "" {
+		id = defaultSessionID
 	}
 
-	// Запускаем генерацию в отдельной горутине
-	stopGeneration = make(chan bool)
-	isGenerating = true
-
-	go generateSineWaveData(database.DB, stopGeneration, request.Interval, request.ChartID)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Генерация синусоиды запущена",
-		"status":   "running",
-		"interval": request.Interval,
-	})
-}
-
-// StopGenerationHandler останавливает генерацию данных
-func StopGenerationHandler(c *gin.Context) {
-	generationMutex.Lock()
-	defer generationMutex.Unlock()
-
-	if !isGenerating {
+	// Отправляем сигнал остановки
+	if _, ok := sessions.stop(id); !ok {
 		c.JSON(http.StatusConflict, gin.H{
 			"error": "Генерация не запущена",
 		})
 		return
 	}
 
-	// Отправляем сигнал остановки
-	close(stopGeneration)
-	isGenerating = false
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Генерация данных остановлена",
 		"status":  "stopped",
 	})
 }
 
-// GenerationStatusHandler возвращает статус генерации
+// GenerationStatusHandler возвращает статус генерации по всем сессиям
 func GenerationStatusHandler(c *gin.Context) {
-	generationMutex.Lock()
-	defer generationMutex.Unlock()
+	list := sessions.list()
 
 	status := "stopped"
-	if isGenerating {
+	if len(list) > 0 {
 		status = "running"
 	}
 
+	stream := hub.stats()
 	c.JSON(http.StatusOK, gin.H{
-		"isGenerating": isGenerating,
+		"isGenerating": len(list) > 0,
 		"status":       status,
-		"clients":      len(clients),
+		"sessions":     list,
+		"clients":      stream.Connections,
+		"stream":       stream,
+		"writer":       writer.stats(),
+		"rollups":      rollups.snapshot(),
 		"message":      "Текущий статус генерации",
 	})
 }
 
-// GetLatestDataHandler возвращает последние данные
+// GetLatestDataHandler возвращает последние limit измерений в порядке времени
 func GetLatestDataHandler(c *gin.Context) {
 	var request struct {
-		Limit   int    `form:"limit" binding:"required"`
-		Type    string `form:"type"`    // "current" или "voltage"
-		ChartID string `form:"chartId"` // ID графика
+		measurementFilter
+		Limit int    `form:"limit" binding:"required"`
+		Type  string `form:"type"` // "current" или "voltage"
 	}
 
 	if err := c.ShouldBindQuery(&request); err != nil {
@@ -211,10 +133,15 @@ func GetLatestDataHandler(c *gin.Context) {
 		request.Limit = 1000
 	}
 
+	dbQuery, ok := request.query(c)
+	if !ok {
+		return
+	}
+
 	// Запрос к БД
 	var measurements []CurrentMeasurement
-	result := database.DB.Table("current_measurements").
-		Order("measurement_time DESC").
+	result := dbQuery.
+		Order("measurement_time DESC, id DESC").
 		Limit(request.Limit).
 		Find(&measurements)
 
@@ -223,163 +150,137 @@ func GetLatestDataHandler(c *gin.Context) {
 		return
 	}
 
-	// Преобразуем в формат для графика
-	var chartData []ChartData
-	startTime := time.Now()
-
-	for i := len(measurements) - 1; i >= 0; i-- {
-		m := measurements[i]
-
-		// Вычисляем время в секундах относительно начала
-		timeSinceStart := startTime.Sub(m.MeasurementTime).Seconds()
-		timeValue := math.Abs(timeSinceStart)
-
-		// Ток
-		if request.Type == "" || request.Type == "current" {
-			chartData = append(chartData, ChartData{
-				Type:      "current",
-				Time:      timeValue,
-				Value:     m.CurrentValue,
-				ChartID:   request.ChartID,
-				Timestamp: m.MeasurementTime,
-				Overload:  m.IsOverload,
-			})
-		}
-
-		// Напряжение
-		if request.Type == "" || request.Type == "voltage" {
-			chartData = append(chartData, ChartData{
-				Type:      "voltage",
-				Time:      timeValue,
-				Value:     m.VoltageValue,
-				ChartID:   request.ChartID,
-				Timestamp: m.MeasurementTime,
-				Overload:  m.IsOverload,
-			})
-		}
+	// Возвращаем в порядке возрастания времени
+	for i, j := 0, len(measurements)-1; i < j; i, j = i+1, j-1 {
+		measurements[i], measurements[j] = measurements[j], measurements[i]
 	}
+	points := measurementPoints(measurements, request.Type, request.ChartID)
 
 	c.JSON(http.StatusOK, gin.H{
-		"data":    chartData,
-		"count":   len(chartData),
+		"data":    points,
+		"count":   len(points),
+		"table":   request.Table,
 		"type":    request.Type,
 		"chartId": request.ChartID,
 	})
 }
 
-// Функция генерации синусоидальных данных
-func generateSineWaveData(db *gorm.DB, stopChan chan bool, interval int, chartID string) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+// Функция генерации данных по описанию сигналов сессии.
+// Отсчеты идут с частотой cfg.SampleRate и точными метками времени
+// startTime + k/SampleRate; на каждом тике выдаются все накопившиеся отсчеты,
+// поэтому задержки планировщика не искажают форму сигнала.
+func generateSineWaveData(session *generationSession) {
+	cfg := session.cfg
+	chartID := cfg.ChartID
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Millisecond)
 	defer ticker.Stop()
 
 	// Начальное время для относительного отсчета
 	startTime := time.Now()
 
-	// Параметры синусоид
-	currentAmplitude := 2.0      // Амплитуда тока
-	currentFrequency := 0.5      // Частота тока (0.5 Гц)
-	currentOffset := 2.0         // Смещение тока
-	
-	voltageAmplitude := 4.0      // Амплитуда напряжения
-	voltageFrequency := 0.3      // Частота напряжения (0.3 Гц)
-	voltageOffset := 6.0         // Смещение напряжения
+	generator := newWaveformGenerator(*cfg.Waveform, cfg.Scenario)
+	period := 1 / cfg.SampleRate
+	var emitted int64 // номер следующего отсчета
 
 	for {
 		select {
-		case <-stopChan:
-			log.Println("Генерация синусоиды остановлена")
+		case <-session.stop:
+			log.Printf("Генерация синусоиды остановлена (сессия %s)", cfg.ID)
 			return
 		case <-ticker.C:
-			// Текущее время в секундах от начала генерации
-			elapsed := time.Since(startTime)
-			timeInSeconds := elapsed.Seconds()
-
-			// Генерация синусоидальных значений
-			currentValue := currentAmplitude*math.Sin(2*math.Pi*currentFrequency*timeInSeconds) + currentOffset
-			voltageValue := voltageAmplitude*math.Sin(2*math.Pi*voltageFrequency*timeInSeconds) + voltageOffset
-
-			// Округляем до 3 знаков
-			currentValue = math.Round(currentValue*1000) / 1000
-			voltageValue = math.Round(voltageValue*1000) / 1000
-
-			// Создаем данные для графика
-			currentData := ChartData{
-				Type:      "current",
-				Time:      timeInSeconds,
-				Value:     currentValue,
-				ChartID:   chartID,
-				Timestamp: time.Now(),
-				Overload:  false,
-			}
-
-			voltageData := ChartData{
-				Type:      "voltage",
-				Time:      timeInSeconds,
-				Value:     voltageValue,
-				ChartID:   chartID,
-				Timestamp: time.Now(),
-				Overload:  false,
+			// Сколько отсчетов должно быть выдано к текущему моменту
+			due := int64(time.Since(startTime).Seconds()*cfg.SampleRate) + 1
+			if due-emitted > maxBlockSamples {
+				// Сильно отстали - догоняем за несколько тиков
+				due = emitted + maxBlockSamples
 			}
 
-			// Отправляем через WebSocket
-			broadcast <- currentData
-			broadcast <- voltageData
-
-			// Сохраняем в БД
-			measurement := CurrentMeasurement{
-				MeasurementTime: time.Now(),
-				CurrentValue:    currentValue,
-				VoltageValue:    voltageValue,
-				CircuitID:       "circuit_B",
-				SensorModel:     "I-Sensor-Pro",
-				IsOverload:      false,
+			measurements := make([]CurrentMeasurement, 0, due-emitted)
+			for ; emitted < due; emitted++ {
+				timeInSeconds := float64(emitted) * period
+				timestamp := startTime.Add(time.Duration(timeInSeconds * float64(time.Second)))
+
+				values := generator.sample(timeInSeconds)
+
+				// Отправляем через WebSocket
+				for _, v := range values {
+					broadcast <- ChartData{
+						Type:      v.Type,
+						Time:      timeInSeconds,
+						Value:     v.Value,
+						ChartID:   chartID,
+						Timestamp: timestamp,
+						Overload:  v.Overload,
+					}
+				}
+
+				currentValue, voltageValue, overload := primaryValues(values)
+				measurements = append(measurements, CurrentMeasurement{
+					MeasurementTime: timestamp,
+					CurrentValue:    currentValue,
+					VoltageValue:    voltageValue,
+					CircuitID:       cfg.CircuitID,
+					SensorModel:     cfg.SensorModel,
+					IsOverload:      overload,
+				})
 			}
 
-			err := insertData(db, measurement)
-			if err != nil {
-				log.Printf("Ошибка вставки данных: %v", err)
-			}
+			// Сохраняем блок в БД через асинхронную запись пачками
+			session.samples.Add(uint64(len(measurements)))
+			writer.enqueue(cfg.Table, measurements)
 		}
 	}
 }
 
-// Вставка данных в БД
-func insertData(db *gorm.DB, data CurrentMeasurement) error {
-	// Форматируем время в строку
-	timeStr := data.MeasurementTime.UTC().Format(time.RFC3339Nano)
-	
-	measurement := map[string]interface{}{
-		"measurement_time": timeStr,
-		"current_value":    data.CurrentValue,
-		"voltage_value":    data.VoltageValue,
-		"circuit_id":       data.CircuitID,
-		"sensor_model":     data.SensorModel,
-		"is_overload":      data.IsOverload,
+// Вставка блока измерений в БД
+func insertData(db *gorm.DB, table string, data []CurrentMeasurement) error {
+	if len(data) == 0 {
+		return nil
 	}
 
-	result := db.Table("current_measurements").Create(measurement)
-	
-	if result.Error != nil {
-		// Альтернативный подход с более простым SQL
-		sql := `INSERT INTO current_measurements 
-				(measurement_time, current_value, voltage_value, circuit_id, sensor_model, is_overload) 
-				VALUES (?, ?, ?, ?, ?, ?)`
-		
-		result = db.Exec(sql, timeStr, data.CurrentValue, data.VoltageValue,
-			data.CircuitID, data.SensorModel, data.IsOverload)
+	rows := make([]map[string]interface{}, len(data))
+	for i, d := range data {
+		rows[i] = map[string]interface{}{
+			"measurement_time": d.MeasurementTime.UTC(),
+			"current_value":    d.CurrentValue,
+			"voltage_value":    d.VoltageValue,
+			"circuit_id":       d.CircuitID,
+			"sensor_model":     d.SensorModel,
+			"is_overload":      d.IsOverload,
+		}
+	}
+
+	result := db.Table(table).Create(rows)
+	if result.Error == nil {
+		return nil
 	}
 
-	return result.Error
+	// Альтернативный подход с более простым SQL, построчно
+	sql := `INSERT INTO ` + table + ` 
+			(measurement_time, current_value, voltage_value, circuit_id, sensor_model, is_overload) 
+			VALUES (?, ?, ?, ?, ?, ?)`
+
+	for _, row := range rows {
+		err := db.Exec(sql, row["measurement_time"], row["current_value"], row["voltage_value"],
+			row["circuit_id"], row["sensor_model"], row["is_overload"]).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// API для получения истории данных
+// GetDataHistoryHandler возвращает историю измерений по страницам.
+// Пагинация по ключу (measurement_time, id): nextCursor из ответа передается
+// в параметре cursor следующего запроса.
 func GetDataHistoryHandler(c *gin.Context) {
 	var request struct {
+		measurementFilter
 		StartTime string `form:"startTime"`
 		EndTime   string `form:"endTime"`
 		Limit     int    `form:"limit"`
+		Cursor    string `form:"cursor"`
 		Type      string `form:"type"`
-		ChartID   string `form:"chartId"`
 	}
 
 	if err := c.ShouldBindQuery(&request); err != nil {
@@ -387,11 +288,11 @@ func GetDataHistoryHandler(c *gin.Context) {
 		return
 	}
 
-	if request.Limit == 0 {
+	if request.Limit <= 0 {
 		request.Limit = 1000
 	}
-	if request.Limit > 5000 {
-		request.Limit = 5000
+	if request.Limit > maxHistoryPageSize {
+		request.Limit = maxHistoryPageSize
 	}
 
 	// Парсим время
@@ -399,7 +300,7 @@ func GetDataHistoryHandler(c *gin.Context) {
 	var err error
 
 	if request.StartTime != "" {
-		startTime, err = time.Parse(time.RFC3339, request.StartTime)
+		startTime, err = time.Parse(time.RFC3339Nano, request.StartTime)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат startTime"})
 			return
@@ -407,7 +308,7 @@ func GetDataHistoryHandler(c *gin.Context) {
 	}
 
 	if request.EndTime != "" {
-		endTime, err = time.Parse(time.RFC3339, request.EndTime)
+		endTime, err = time.Parse(time.RFC3339Nano, request.EndTime)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат endTime"})
 			return
@@ -415,7 +316,10 @@ func GetDataHistoryHandler(c *gin.Context) {
 	}
 
 	// Запрос к БД
-	dbQuery := database.DB.Table("current_measurements")
+	dbQuery, ok := request.query(c)
+	if !ok {
+		return
+	}
 
 	if !startTime.IsZero() {
 		dbQuery = dbQuery.Where("measurement_time >= ?", startTime)
@@ -423,11 +327,22 @@ func GetDataHistoryHandler(c *gin.Context) {
 	if !endTime.IsZero() {
 		dbQuery = dbQuery.Where("measurement_time <= ?", endTime)
 	}
+	if request.Cursor != "" {
+		after, id, err := decodeHistoryCursor(request.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный cursor"})
+			return
+		}
+		// Отдельное условие на measurement_time позволяет PostgreSQL
+		// отбросить секции до курсора: сравнение кортежей для этого не годится
+		dbQuery = dbQuery.Where("measurement_time >= ? AND (measurement_time, id) > (?, ?)", after, after, id)
+	}
 
+	// Лишняя строка показывает, есть ли следующая страница
 	var measurements []CurrentMeasurement
 	result := dbQuery.
-		Order("measurement_time ASC").
-		Limit(request.Limit).
+		Order("measurement_time ASC, id ASC").
+		Limit(request.Limit + 1).
 		Find(&measurements)
 
 	if result.Error != nil {
@@ -435,41 +350,22 @@ func GetDataHistoryHandler(c *gin.Context) {
 		return
 	}
 
-	// Преобразуем в формат для графика
-	var chartData []ChartData
-	referenceTime := time.Now()
-
-	for _, m := range measurements {
-		// Время в секундах относительно текущего момента
-		timeDiff := referenceTime.Sub(m.MeasurementTime).Seconds()
-
-		if request.Type == "" || request.Type == "current" {
-			chartData = append(chartData, ChartData{
-				Type:      "current",
-				Time:      math.Abs(timeDiff),
-				Value:     m.CurrentValue,
-				ChartID:   request.ChartID,
-				Timestamp: m.MeasurementTime,
-				Overload:  m.IsOverload,
-			})
-		}
-
-		if request.Type == "" || request.Type == "voltage" {
-			chartData = append(chartData, ChartData{
-				Type:      "voltage",
-				Time:      math.Abs(timeDiff),
-				Value:     m.VoltageValue,
-				ChartID:   request.ChartID,
-				Timestamp: m.MeasurementTime,
-				Overload:  m.IsOverload,
-			})
-		}
+	var nextCursor string
+	if len(measurements) > request.Limit {
+		measurements = measurements[:request.Limit]
+		last := measurements[len(measurements)-1]
+		nextCursor = encodeHistoryCursor(last.MeasurementTime, last.ID)
 	}
+	points := measurementPoints(measurements, request.Type, request.ChartID)
 
 	c.JSON(http.StatusOK, gin.H{
-		"data":    chartData,
-		"count":   len(chartData),
-		"type":    request.Type,
-		"chartId": request.ChartID,
+		"data":         points,
+		"count":        len(points),
+		"measurements": len(measurements),
+		"nextCursor":   nextCursor,
+		"hasMore":      nextCursor != "",
+		"table":        request.Table,
+		"type":         request.Type,
+		"chartId":      request.ChartID,
 	})
-}
\ No newline at end of file
+}
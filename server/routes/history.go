@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Максимум измерений на странице истории
+const maxHistoryPageSize = 5000
+
+// Точка измерения в ответах /api/v1 с абсолютной меткой времени
+type MeasurementPoint struct {
+	ID          int       `json:"id"`
+	Type        string    `json:"type"` // "current" или "voltage"
+	Value       float64   `json:"value"`
+	Timestamp   time.Time `json:"timestamp"`
+	CircuitID   string    `json:"circuitId"`
+	SensorModel string    `json:"sensorModel"`
+	Overload    bool      `json:"overload"`
+	ChartID     string    `json:"chartId,omitempty"`
+}
+
+// Общие параметры выборки измерений
+type measurementFilter struct {
+	Table       string `form:"table"`
+	CircuitID   string `form:"circuitId"`
+	SensorModel string `form:"sensorModel"`
+	ChartID     string `form:"chartId"` // ID графика, только для разметки ответа
+}
+
+// Запрос к таблице измерений с фильтрами по цепи и модели датчика.
+// Таблица по умолчанию - таблица генерации. При ошибке отвечает клиенту.
+func (f *measurementFilter) query(c *gin.Context) (*gorm.DB, bool) {
+	if f.Table == "" {
+		f.Table = generationDefaults.Table
+	}
+
+	tables, err := allowedTables()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tables list: " + err.Error()})
+		return nil, false
+	}
+	if !containsString(tables, f.Table) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Таблица не найдена: " + f.Table})
+		return nil, false
+	}
+	if !authorize(c, PermRead, f.Table) {
+		return nil, false
+	}
+
+	dbQuery := database.DB.Table(f.Table)
+	if f.CircuitID != "" {
+		dbQuery = dbQuery.Where("circuit_id = ?", f.CircuitID)
+	}
+	if f.SensorModel != "" {
+		dbQuery = dbQuery.Where("sensor_model = ?", f.SensorModel)
+	}
+	return dbQuery, true
+}
+
+// Разворачивает измерения в точки тока и напряжения
+func measurementPoints(measurements []CurrentMeasurement, kind, chartID string) []MeasurementPoint {
+	points := make([]MeasurementPoint, 0, 2*len(measurements))
+	for _, m := range measurements {
+		point := MeasurementPoint{
+			ID:          m.ID,
+			Timestamp:   m.MeasurementTime,
+			CircuitID:   m.CircuitID,
+			SensorModel: m.SensorModel,
+			Overload:    m.IsOverload,
+			ChartID:     chartID,
+		}
+		if kind == "" || kind == "current" {
+			point.Type, point.Value = "current", m.CurrentValue
+			points = append(points, point)
+		}
+		if kind == "" || kind == "voltage" {
+			point.Type, point.Value = "voltage", m.VoltageValue
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// Курсор истории: время и id последнего измерения страницы
+func encodeHistoryCursor(t time.Time, id int) string {
+	raw := t.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	ts, idText, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("неверный формат курсора")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return t, id, nil
+}
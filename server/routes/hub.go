@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Политика при переполнении очереди отправки клиента
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // выбросить самые старые сообщения
+	OverflowCoalesce   OverflowPolicy = "coalesce"    // объединить данные в ChartDataBatch
+	OverflowDisconnect OverflowPolicy = "disconnect"  // отключить медленного клиента
+)
+
+// Настройки потоковой передачи
+type StreamConfig struct {
+	SendQueueSize int            // размер очереди отправки на клиента
+	Overflow      OverflowPolicy // политика переполнения очереди
+	WriteTimeout  time.Duration  // дедлайн записи одного сообщения
+	PongTimeout   time.Duration  // сколько ждать pong от клиента
+}
+
+// Настройки по умолчанию
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		SendQueueSize: 256,
+		Overflow:      OverflowDropOldest,
+		WriteTimeout:  10 * time.Second,
+		PongTimeout:   60 * time.Second,
+	}
+}
+
+func (cfg StreamConfig) validate() error {
+	if cfg.SendQueueSize <= 0 {
+		return fmt.Errorf("размер очереди отправки должен быть положительным")
+	}
+	switch cfg.Overflow {
+	case OverflowDropOldest, OverflowCoalesce, OverflowDisconnect:
+	default:
+		return fmt.Errorf("неизвестная политика переполнения: %q", cfg.Overflow)
+	}
+	if cfg.WriteTimeout <= 0 || cfg.PongTimeout <= 0 {
+		return fmt.Errorf("таймауты должны быть положительными")
+	}
+	return nil
+}
+
+// Интервал отправки ping - немного меньше таймаута pong
+func (cfg StreamConfig) pingPeriod() time.Duration {
+	return cfg.PongTimeout * 9 / 10
+}
+
+// Статистика хаба для статуса генерации
+type StreamStats struct {
+	Connections  int            `json:"connections"`
+	Dropped      uint64         `json:"dropped"`
+	Coalesced    uint64         `json:"coalesced"`
+	Disconnected uint64         `json:"disconnected"`
+	Overflow     OverflowPolicy `json:"overflow"`
+}
+
+// Хаб WebSocket клиентов
+type wsHub struct {
+	mu      sync.RWMutex
+	clients map[*wsClient]bool
+	cfg     StreamConfig
+
+	dropped      atomic.Uint64
+	coalesced    atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+var hub = newHub(DefaultStreamConfig())
+
+func newHub(cfg StreamConfig) *wsHub {
+	return &wsHub{
+		clients: make(map[*wsClient]bool),
+		cfg:     cfg,
+	}
+}
+
+// ValidateStreamConfig проверяет настройки потоковой передачи
+func ValidateStreamConfig(cfg StreamConfig) error {
+	return cfg.validate()
+}
+
+// ConfigureStream задает настройки потоковой передачи.
+// Действует на клиентов, подключившихся после вызова.
+func ConfigureStream(cfg StreamConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	hub.mu.Lock()
+	hub.cfg = cfg
+	hub.mu.Unlock()
+	return nil
+}
+
+func (h *wsHub) config() StreamConfig {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cfg
+}
+
+func (h *wsHub) register(cl *wsClient) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[cl] = true
+	return len(h.clients)
+}
+
+func (h *wsHub) unregister(cl *wsClient) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, cl)
+	return len(h.clients)
+}
+
+// Рассылка данных подписанным клиентам. Не блокируется на медленных клиентах.
+func (h *wsHub) publish(data ChartData) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for cl := range h.clients {
+		if window, maxSamples, ok := cl.match(data); ok {
+			cl.deliver(data, window, maxSamples)
+		}
+	}
+}
+
+func (h *wsHub) stats() StreamStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return StreamStats{
+		Connections:  len(h.clients),
+		Dropped:      h.dropped.Load(),
+		Coalesced:    h.coalesced.Load(),
+		Disconnected: h.disconnected.Load(),
+		Overflow:     h.cfg.Overflow,
+	}
+}
+
+// Постановка сообщения в очередь отправки клиента
+func (cl *wsClient) enqueue(msg interface{}) {
+	cl.queueMu.Lock()
+	defer cl.queueMu.Unlock()
+
+	if cl.closed {
+		return
+	}
+
+	if len(cl.queue) >= cl.cfg.SendQueueSize {
+		switch cl.cfg.Overflow {
+		case OverflowDisconnect:
+			cl.hub.disconnected.Add(1)
+			log.Printf("WebSocket client is too slow, disconnecting")
+			cl.closeLocked()
+			return
+		case OverflowCoalesce:
+			cl.coalesceLocked()
+		}
+		// Если объединять нечего, выбрасываем самое старое сообщение
+		if len(cl.queue) >= cl.cfg.SendQueueSize {
+			cl.queue = cl.queue[1:]
+			cl.hub.dropped.Add(1)
+		}
+	}
+
+	cl.queue = append(cl.queue, msg)
+
+	select {
+	case cl.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Объединяет ожидающие данные в один ChartDataBatch на график.
+// Управляющие ответы сохраняются в исходном порядке.
+func (cl *wsClient) coalesceLocked() {
+	batches := make(map[string]*ChartDataBatch)
+	var order []string
+	queue := cl.queue[:0:0]
+	merged := 0
+
+	for _, msg := range cl.queue {
+		var items []ChartData
+		var chartID string
+		switch m := msg.(type) {
+		case ChartData:
+			items, chartID = []ChartData{m}, m.ChartID
+		case *ChartDataBatch:
+			items, chartID = m.Data, m.ChartID
+		default:
+			queue = append(queue, msg)
+			continue
+		}
+
+		b, ok := batches[chartID]
+		if !ok {
+			b = &ChartDataBatch{Type: "batch", ChartID: chartID}
+			batches[chartID] = b
+			order = append(order, chartID)
+		}
+		b.Data = append(b.Data, items...)
+		merged++
+	}
+
+	for _, chartID := range order {
+		queue = append(queue, batches[chartID])
+	}
+	if merged > len(order) {
+		cl.hub.coalesced.Add(uint64(merged - len(order)))
+	}
+	cl.queue = queue
+}
+
+// Закрывает клиента; вызывается под queueMu
+func (cl *wsClient) closeLocked() {
+	if cl.closed {
+		return
+	}
+	cl.closed = true
+	cl.queue = nil
+	close(cl.done)
+	cl.stopBatches()
+	cl.conn.Close()
+}
+
+func (cl *wsClient) close() {
+	cl.queueMu.Lock()
+	defer cl.queueMu.Unlock()
+	cl.closeLocked()
+}
+
+// Горутина записи: отправляет очередь, ping и соблюдает дедлайны записи
+func (cl *wsClient) writePump() {
+	ticker := time.NewTicker(cl.cfg.pingPeriod())
+	defer func() {
+		ticker.Stop()
+		cl.close()
+	}()
+
+	for {
+		select {
+		case <-cl.done:
+			return
+		case <-cl.notify:
+			cl.queueMu.Lock()
+			pending := cl.queue
+			cl.queue = nil
+			cl.queueMu.Unlock()
+
+			for _, msg := range pending {
+				messageType, payload, err := cl.encode(msg)
+				if err != nil {
+					log.Printf("WebSocket encode error: %v", err)
+					continue
+				}
+				cl.conn.SetWriteDeadline(time.Now().Add(cl.cfg.WriteTimeout))
+				if err := cl.conn.WriteMessage(messageType, payload); err != nil {
+					log.Printf("WebSocket write error: %v", err)
+					return
+				}
+			}
+		case <-ticker.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(cl.cfg.WriteTimeout))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
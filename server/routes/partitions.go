@@ -0,0 +1,616 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Длина секции
+const (
+	PartitionDaily   = "day"
+	PartitionMonthly = "month"
+)
+
+// Секционирование таблицы по диапазонам времени
+type PartitionRule struct {
+	Table   string `json:"table"`
+	Column  string `json:"column"`  // по умолчанию measurement_time, для агрегатов - bucket
+	Period  string `json:"period"`  // day или month
+	Premake int    `json:"premake"` // будущих секций заранее; 0 - 7 дней или 2 месяца
+}
+
+// Настройки обслуживания секций
+type PartitionConfig struct {
+	CheckInterval time.Duration // период проверки и создания будущих секций
+	Tables        []PartitionRule
+}
+
+// DefaultPartitionConfig возвращает настройки по умолчанию: таблицы не секционируются
+func DefaultPartitionConfig() PartitionConfig {
+	return PartitionConfig{CheckInterval: time.Hour}
+}
+
+// Колонка времени по умолчанию для таблиц измерений и агрегатов
+func defaultTimeColumn(table string) string {
+	if isRollupTable(table) {
+		return "bucket"
+	}
+	return "measurement_time"
+}
+
+func (r *PartitionRule) normalize() {
+	if r.Column == "" {
+		r.Column = defaultTimeColumn(r.Table)
+	}
+	if r.Period == "" {
+		r.Period = PartitionDaily
+	}
+	if r.Premake == 0 {
+		r.Premake = 7
+		if r.Period == PartitionMonthly {
+			r.Premake = 2
+		}
+	}
+}
+
+// Самый длинный суффикс имени секции: "_p20060102"
+const partitionSuffixLen = 10
+
+// ValidatePartitionConfig проверяет настройки секционирования
+func ValidatePartitionConfig(cfg PartitionConfig) error {
+	if cfg.CheckInterval < time.Minute {
+		return fmt.Errorf("интервал проверки не может быть меньше 1m")
+	}
+	seen := map[string]bool{}
+	for i, r := range cfg.Tables {
+		r.normalize()
+		if !identifierPattern.MatchString(r.Table) || len(r.Table) > 63-partitionSuffixLen {
+			return fmt.Errorf("правило %d: недопустимое имя таблицы: %q", i, r.Table)
+		}
+		if seen[r.Table] {
+			return fmt.Errorf("правило %d: таблица %s указана повторно", i, r.Table)
+		}
+		seen[r.Table] = true
+		if isServiceTable(r.Table) && !isRollupTable(r.Table) {
+			return fmt.Errorf("правило %d: таблица %s не секционируется", i, r.Table)
+		}
+		if !identifierPattern.MatchString(r.Column) {
+			return fmt.Errorf("правило %d: недопустимое имя колонки: %q", i, r.Column)
+		}
+		if r.Period != PartitionDaily && r.Period != PartitionMonthly {
+			return fmt.Errorf("правило %d: период %q, ожидается day или month", i, r.Period)
+		}
+		if r.Premake < 0 || r.Premake > 366 {
+			return fmt.Errorf("правило %d: premake должен быть от 0 до 366", i)
+		}
+	}
+	return nil
+}
+
+// Начало секции, в которую попадает t (UTC)
+func (r PartitionRule) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	if r.Period == PartitionMonthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Начало следующей секции
+func (r PartitionRule) next(start time.Time) time.Time {
+	if r.Period == PartitionMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func (r PartitionRule) partitionName(start time.Time) string {
+	if r.Period == PartitionMonthly {
+		return r.Table + "_p" + start.Format("200601")
+	}
+	return r.Table + "_p" + start.Format("20060102")
+}
+
+// Секция таблицы в метаданных
+type PartitionInfo struct {
+	Name         string     `json:"name"`
+	From         *time.Time `json:"from"` // null - MINVALUE
+	To           *time.Time `json:"to"`   // null - MAXVALUE
+	IsDefault    bool       `json:"isDefault"`
+	RowsEstimate int64      `json:"rowsEstimate"` // оценка по статистике
+}
+
+// Схема секционирования таблицы
+type PartitionLayout struct {
+	Key        string          `json:"key"`              // например "RANGE (measurement_time)"
+	Period     string          `json:"period,omitempty"` // если секциями управляет сервер
+	Premake    int             `json:"premake,omitempty"`
+	Partitions []PartitionInfo `json:"partitions"`
+}
+
+type partitionManager struct {
+	cfg PartitionConfig
+
+	mu sync.Mutex // одна проверка одновременно
+}
+
+var partitions = &partitionManager{cfg: DefaultPartitionConfig()}
+
+// ConfigurePartitions запускает создание будущих секций таблиц из конфигурации
+// по расписанию. Обычная таблица на секционирование при запуске не переводится:
+// это делает подкоманда EPS partition convert (см. ConvertPartitioned).
+func ConfigurePartitions(db *gorm.DB, cfg PartitionConfig) error {
+	if err := ValidatePartitionConfig(cfg); err != nil {
+		return err
+	}
+	for i := range cfg.Tables {
+		cfg.Tables[i].normalize()
+	}
+	partitions = &partitionManager{cfg: cfg}
+	if len(cfg.Tables) == 0 {
+		return nil
+	}
+
+	partitions.maintain(db)
+	go func() {
+		ticker := time.NewTicker(cfg.CheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			partitions.maintain(db)
+		}
+	}()
+	return nil
+}
+
+func (m *partitionManager) maintain(db *gorm.DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rule := range m.cfg.Tables {
+		if err := m.ensure(db, rule, time.Now()); err != nil {
+			log.Printf("Ошибка обслуживания секций %s: %v", rule.Table, err)
+		}
+	}
+}
+
+// Правило для таблицы, если ее секциями управляет сервер
+func (m *partitionManager) rule(table string) (PartitionRule, bool) {
+	for _, r := range m.cfg.Tables {
+		if r.Table == table {
+			return r, true
+		}
+	}
+	return PartitionRule{}, false
+}
+
+// Переводит таблицу на секционирование при необходимости и создает
+// секции с текущей по Premake вперед, а также секцию DEFAULT
+func (m *partitionManager) ensure(db *gorm.DB, rule PartitionRule, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Несколько экземпляров сервера не обслуживают таблицу одновременно
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "partitions:"+rule.Table).Error; err != nil {
+			return err
+		}
+
+		layout, kind, err := partitionLayout(tx, rule.Table)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case "":
+			return fmt.Errorf("таблица не найдена")
+		case "r":
+			return fmt.Errorf("таблица еще не секционирована, выполните: EPS partition convert %s", rule.Table)
+		case "p":
+			if layout.Key != fmt.Sprintf("RANGE (%s)", rule.Column) {
+				return fmt.Errorf("таблица секционирована по %s, ожидается RANGE (%s)", layout.Key, rule.Column)
+			}
+		default:
+			return fmt.Errorf("%s не является таблицей", rule.Table)
+		}
+
+		// Секция DEFAULT принимает строки вне созданных диапазонов
+		defaultName := ""
+		for _, p := range layout.Partitions {
+			if p.IsDefault {
+				defaultName = p.Name
+			}
+		}
+		if defaultName == "" {
+			defaultName = rule.Table + "_default"
+			err := tx.Exec(fmt.Sprintf("CREATE TABLE %s PARTITION OF %s DEFAULT",
+				quoteIdentifier(defaultName), quoteIdentifier(rule.Table))).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		start := rule.periodStart(now)
+		for i := 0; i <= rule.Premake; i++ {
+			end := rule.next(start)
+			if !overlapsPartition(layout.Partitions, start, end) {
+				if err := createPartition(tx, rule, defaultName, start, end); err != nil {
+					return fmt.Errorf("секция %s: %w", rule.partitionName(start), err)
+				}
+				log.Printf("Создана секция %s", rule.partitionName(start))
+			}
+			start = end
+		}
+		return nil
+	})
+}
+
+func overlapsPartition(list []PartitionInfo, start, end time.Time) bool {
+	for _, p := range list {
+		if p.IsDefault {
+			continue
+		}
+		if (p.From == nil || p.From.Before(end)) && (p.To == nil || p.To.After(start)) {
+			return true
+		}
+	}
+	return false
+}
+
+func partitionBound(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339) + "'"
+}
+
+// Создает секцию [start, end). Строки этого диапазона, попавшие ранее
+// в секцию DEFAULT, переносятся в новую секцию.
+func createPartition(tx *gorm.DB, rule PartitionRule, defaultName string, start, end time.Time) error {
+	table := quoteIdentifier(rule.Table)
+	name := quoteIdentifier(rule.partitionName(start))
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING STORAGE)", name, table),
+		fmt.Sprintf(`WITH moved AS (
+			DELETE FROM %s WHERE %s >= %s AND %s < %s RETURNING *
+		) INSERT INTO %s SELECT * FROM moved`,
+			quoteIdentifier(defaultName),
+			quoteIdentifier(rule.Column), partitionBound(start), quoteIdentifier(rule.Column), partitionBound(end), name),
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)",
+			table, name, partitionBound(start), partitionBound(end)),
+	}
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertPartitioned переводит обычную таблицу из конфигурации на секционирование
+// и создает секции. Таблица переименовывается в <table>_legacy и без копирования
+// строк подключается секцией от MINVALUE до конца следующего периода (считая
+// от текущего или от периода последнего измерения). Первичный ключ дополняется колонкой секционирования,
+// обычные индексы и триггеры переносятся на новую таблицу.
+//
+// Долгие шаги выполняются без ACCESS EXCLUSIVE: ограничение CHECK с границей
+// секции добавляется NOT VALID и проверяется VALIDATE, уникальный индекс нового
+// ключа строится CONCURRENTLY. Запись в таблицу блокируется только на время
+// переименования и ATTACH PARTITION, которому проверенное ограничение позволяет
+// не сканировать таблицу.
+func ConvertPartitioned(db *gorm.DB, cfg PartitionConfig, table string) error {
+	if err := ValidatePartitionConfig(cfg); err != nil {
+		return err
+	}
+	m := &partitionManager{cfg: cfg}
+	for i := range m.cfg.Tables {
+		m.cfg.Tables[i].normalize()
+	}
+	rule, ok := m.rule(table)
+	if !ok {
+		return fmt.Errorf("таблица %s не указана в partitioning.tables", table)
+	}
+
+	_, kind, err := partitionLayout(db, rule.Table)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "":
+		return fmt.Errorf("таблица %s не найдена", rule.Table)
+	case "p":
+		log.Printf("Таблица %s уже секционирована", rule.Table)
+	case "r":
+		now := time.Now()
+		plan, err := preparePartitioning(db, rule, now)
+		if err != nil {
+			return fmt.Errorf("подготовка %s: %w", rule.Table, err)
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "partitions:"+rule.Table).Error; err != nil {
+				return err
+			}
+			// Таблицу мог перевести другой экземпляр, пока шла подготовка
+			if _, kind, err := partitionLayout(tx, rule.Table); err != nil || kind != "r" {
+				return err
+			}
+			return attachLegacyPartition(tx, rule, plan)
+		})
+		if err != nil {
+			return fmt.Errorf("перевод %s на секционирование: %w", rule.Table, err)
+		}
+	default:
+		return fmt.Errorf("%s не является таблицей", rule.Table)
+	}
+
+	return m.ensure(db, rule, time.Now())
+}
+
+// Подготовка перевода таблицы на секционирование
+type partitionPlan struct {
+	bound      time.Time // верхняя граница секции с прежними данными
+	primaryKey []string  // новый первичный ключ
+	keyIndex   string    // уникальный индекс нового ключа на прежней таблице; пусто - не нужен
+	check      string    // ограничение CHECK с границей секции
+}
+
+// Проверяет таблицу и готовит ее к подключению секцией без долгих блокировок
+func preparePartitioning(db *gorm.DB, rule PartitionRule, now time.Time) (*partitionPlan, error) {
+	table := quoteIdentifier(rule.Table)
+	column := quoteIdentifier(rule.Column)
+
+	columns, err := getTableColumns(db, rule.Table)
+	if err != nil {
+		return nil, err
+	}
+	columnType := ""
+	for _, col := range columns {
+		if col.ColumnName == rule.Column {
+			columnType = col.DataType
+		}
+	}
+	if !containsString([]string{"timestamp with time zone", "timestamp without time zone", "date"}, columnType) {
+		return nil, fmt.Errorf("колонка %s должна иметь тип даты или времени", rule.Column)
+	}
+
+	var check struct {
+		Identity int
+		Unique   *string
+	}
+	err = db.Raw(`
+		SELECT
+			(SELECT count(*) FROM pg_attribute a
+			 WHERE a.attrelid = t.oid AND a.attidentity <> '') AS identity,
+			(SELECT string_agg(i.relname, ', ') FROM pg_index x
+			 JOIN pg_class i ON i.oid = x.indexrelid
+			 WHERE x.indrelid = t.oid AND x.indisunique AND NOT x.indisprimary
+			 AND NOT EXISTS (
+				SELECT 1 FROM pg_attribute a
+				WHERE a.attrelid = t.oid AND a.attname = ? AND a.attnum = ANY(x.indkey)
+			 )) AS "unique"
+		FROM pg_class t
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = 'public' AND t.relname = ?
+	`, rule.Column, rule.Table).Scan(&check).Error
+	if err != nil {
+		return nil, err
+	}
+	if check.Identity > 0 {
+		return nil, fmt.Errorf("колонки GENERATED AS IDENTITY не поддерживаются")
+	}
+	if check.Unique != nil {
+		return nil, fmt.Errorf("уникальные индексы без колонки %s: %s", rule.Column, *check.Unique)
+	}
+
+	plan := &partitionPlan{check: rule.Table + "_pbound"}
+	plan.primaryKey, err = getPrimaryKey(db, rule.Table)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.primaryKey) > 0 && !containsString(plan.primaryKey, rule.Column) {
+		plan.primaryKey = append(plan.primaryKey, rule.Column)
+		plan.keyIndex = rule.Table + "_pkey_p"
+	}
+
+	// Граница: конец периода последнего измерения, но не раньше конца текущего
+	// периода - иначе ограничение отклоняло бы текущую запись. Еще один период
+	// в запас - на случай, если проверка затянется за границу периода.
+	var maxTime *time.Time
+	if err := db.Raw(fmt.Sprintf("SELECT max(%s) FROM %s", column, table)).Scan(&maxTime).Error; err != nil {
+		return nil, err
+	}
+	latest := now
+	if maxTime != nil && maxTime.After(latest) {
+		latest = *maxTime
+	}
+	plan.bound = rule.next(rule.next(rule.periodStart(latest)))
+
+	// Ограничение повторяет условие секции, чтобы ATTACH PARTITION не сканировал
+	// таблицу. NOT VALID не проверяет строки под ACCESS EXCLUSIVE, VALIDATE
+	// проверяет их под SHARE UPDATE EXCLUSIVE, не мешая записи.
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, quoteIdentifier(plan.check)),
+		fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s IS NOT NULL AND %s < %s::%s) NOT VALID",
+			table, quoteIdentifier(plan.check), column, column, partitionBound(plan.bound), columnType),
+		fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", table, quoteIdentifier(plan.check)),
+	}
+	if plan.keyIndex != "" {
+		quoted := make([]string, len(plan.primaryKey))
+		for i, col := range plan.primaryKey {
+			quoted[i] = quoteIdentifier(col)
+		}
+		// Индекс, оставшийся недостроенным после прерванного запуска, строится заново
+		var valid *bool
+		err := db.Raw(`
+			SELECT x.indisvalid FROM pg_index x
+			JOIN pg_class i ON i.oid = x.indexrelid
+			JOIN pg_namespace n ON n.oid = i.relnamespace
+			WHERE n.nspname = 'public' AND i.relname = ?
+		`, plan.keyIndex).Scan(&valid).Error
+		if err != nil {
+			return nil, err
+		}
+		if valid != nil && !*valid {
+			statements = append(statements, "DROP INDEX CONCURRENTLY "+quoteIdentifier(plan.keyIndex))
+		}
+		if valid == nil || !*valid {
+			statements = append(statements, fmt.Sprintf("CREATE UNIQUE INDEX CONCURRENTLY %s ON %s (%s)",
+				quoteIdentifier(plan.keyIndex), table, strings.Join(quoted, ", ")))
+		}
+	}
+	// Каждая команда - в своей транзакции: CONCURRENTLY внутри транзакции невозможен
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// Переименовывает подготовленную таблицу, создает вместо нее секционированную
+// и подключает прежнюю секцией. Выполняется в транзакции под ACCESS EXCLUSIVE,
+// но без чтения строк таблицы.
+func attachLegacyPartition(tx *gorm.DB, rule PartitionRule, plan *partitionPlan) error {
+	table := quoteIdentifier(rule.Table)
+	legacy := rule.Table + "_legacy"
+	column := quoteIdentifier(rule.Column)
+
+	var indexes []string
+	err := tx.Raw(`
+		SELECT pg_get_indexdef(x.indexrelid)
+		FROM pg_index x
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = 'public' AND t.relname = ? AND NOT x.indisunique
+	`, rule.Table).Scan(&indexes).Error
+	if err != nil {
+		return err
+	}
+
+	var sequences []struct {
+		Column   string
+		Sequence string
+	}
+	err = tx.Raw(`
+		SELECT a.attname AS "column", pg_get_serial_sequence(quote_ident(t.relname), a.attname) AS sequence
+		FROM pg_attribute a
+		JOIN pg_class t ON t.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = 'public' AND t.relname = ? AND a.attnum > 0 AND NOT a.attisdropped
+		AND pg_get_serial_sequence(quote_ident(t.relname), a.attname) IS NOT NULL
+	`, rule.Table).Scan(&sequences).Error
+	if err != nil {
+		return err
+	}
+
+	// Определения триггеров ссылаются на имя таблицы, которое после
+	// переименования перейдет к новой таблице
+	var triggers []struct {
+		Name string
+		Def  string
+	}
+	err = tx.Raw(`
+		SELECT tg.tgname AS name, pg_get_triggerdef(tg.oid) AS def
+		FROM pg_trigger tg
+		JOIN pg_class t ON t.oid = tg.tgrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = 'public' AND t.relname = ? AND NOT tg.tgisinternal
+	`, rule.Table).Scan(&triggers).Error
+	if err != nil {
+		return err
+	}
+
+	var statements []string
+	if plan.keyIndex != "" {
+		// ATTACH PARTITION подключает к первичному ключу только индекс с ограничением
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE USING INDEX %s",
+			table, quoteIdentifier(plan.keyIndex), quoteIdentifier(plan.keyIndex)))
+	}
+	statements = append(statements,
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, quoteIdentifier(legacy)),
+		fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING STORAGE INCLUDING COMMENTS)
+			PARTITION BY RANGE (%s)`, table, quoteIdentifier(legacy), column),
+		// Граница прежних данных не должна ограничивать новую таблицу
+		fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, quoteIdentifier(plan.check)),
+	)
+	if len(plan.primaryKey) > 0 {
+		quoted := make([]string, len(plan.primaryKey))
+		for i, col := range plan.primaryKey {
+			quoted[i] = quoteIdentifier(col)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, strings.Join(quoted, ", ")))
+	}
+	for _, def := range indexes {
+		// CREATE INDEX name ON public.table USING btree (...) - имя подберет PostgreSQL
+		_, using, ok := strings.Cut(def, " USING ")
+		if !ok {
+			return fmt.Errorf("неизвестное определение индекса: %s", def)
+		}
+		statements = append(statements, fmt.Sprintf("CREATE INDEX ON %s USING %s", table, using))
+	}
+	for _, trg := range triggers {
+		statements = append(statements,
+			fmt.Sprintf("DROP TRIGGER %s ON %s", quoteIdentifier(trg.Name), quoteIdentifier(legacy)),
+			trg.Def)
+	}
+	for _, seq := range sequences {
+		statements = append(statements, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s",
+			seq.Sequence, table, quoteIdentifier(seq.Column)))
+	}
+	statements = append(statements,
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO (%s)",
+			table, quoteIdentifier(legacy), partitionBound(plan.bound)),
+		// Условие секции заменяет ограничение
+		fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", quoteIdentifier(legacy), quoteIdentifier(plan.check)),
+	)
+
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	log.Printf("Таблица %s секционирована по %s (%s), прежние данные в секции %s",
+		rule.Table, rule.Column, rule.Period, legacy)
+	return nil
+}
+
+// Схема секционирования таблицы и ее тип (relkind): "r" - обычная,
+// "p" - секционированная, "" - не найдена. Layout заполняется только для "p".
+func partitionLayout(db *gorm.DB, table string) (*PartitionLayout, string, error) {
+	var info struct {
+		Kind string
+		Key  *string
+	}
+	err := db.Raw(`
+		SELECT c.relkind::text AS kind,
+			CASE WHEN c.relkind = 'p' THEN pg_get_partkeydef(c.oid) END AS key
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relname = ?
+	`, table).Scan(&info).Error
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get partitioning for table: %w", err)
+	}
+	if info.Kind != "p" || info.Key == nil {
+		return nil, info.Kind, nil
+	}
+
+	layout := &PartitionLayout{Key: *info.Key, Partitions: []PartitionInfo{}}
+	err = db.Raw(`
+		SELECT c.relname AS name,
+			substring(pg_get_expr(c.relpartbound, c.oid) FROM 'FROM \(''([^'']+)''\)')::timestamptz AS "from",
+			substring(pg_get_expr(c.relpartbound, c.oid) FROM 'TO \(''([^'']+)''\)')::timestamptz AS "to",
+			pg_get_expr(c.relpartbound, c.oid) = 'DEFAULT' AS is_default,
+			GREATEST(c.reltuples, 0)::bigint AS rows_estimate
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = p.relnamespace
+		WHERE n.nspname = 'public' AND p.relname = ?
+		ORDER BY is_default, "from" NULLS FIRST, c.relname
+	`, table).Scan(&layout.Partitions).Error
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get partitions for table: %w", err)
+	}
+
+	if rule, ok := partitions.rule(table); ok {
+		layout.Period, layout.Premake = rule.Period, rule.Premake
+	}
+	return layout, info.Kind, nil
+}
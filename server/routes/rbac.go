@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"EPS/database"
+	"EPS/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Роли пользователей
+const (
+	RoleViewer   = "viewer"   // только чтение
+	RoleOperator = "operator" // запуск и остановка генерации и воспроизведения
+	RoleEditor   = "editor"   // изменение строк таблиц
+	RoleAdmin    = "admin"    // изменение схемы и произвольный SQL
+)
+
+// Роли по возрастанию прав: каждая следующая включает права предыдущих
+var roleOrder = []string{RoleViewer, RoleOperator, RoleEditor, RoleAdmin}
+
+// Действия, на которые проверяются права
+type Permission string
+
+const (
+	PermRead     Permission = "read"      // чтение данных и метаданных, поток графиков
+	PermGenerate Permission = "generate"  // генерация и воспроизведение
+	PermEditRows Permission = "edit_rows" // добавление, изменение и удаление строк
+	PermSchema   Permission = "schema"    // изменение схемы (удаление таблиц)
+	PermRawSQL   Permission = "raw_sql"   // произвольный SQL
+)
+
+// Минимальная роль для действия по умолчанию
+var permissionRoles = map[Permission]string{
+	PermRead:     RoleViewer,
+	PermGenerate: RoleOperator,
+	PermEditRows: RoleEditor,
+	PermSchema:   RoleAdmin,
+	PermRawSQL:   RoleAdmin,
+}
+
+// Переопределения минимальной роли для отдельных таблиц: таблица -> действие -> роль.
+// Переопределение может только повысить требуемую роль: маршруты групп уже
+// проверяют роль по умолчанию в RequirePermission, и понижение не действовало бы.
+type TablePermissions map[string]map[Permission]string
+
+var tablePermissions = TablePermissions{}
+
+// ValidateTablePermissions проверяет правила доступа к таблицам
+func ValidateTablePermissions(rules TablePermissions) error {
+	for table, perms := range rules {
+		if !identifierPattern.MatchString(table) {
+			return fmt.Errorf("недопустимое имя таблицы: %q", table)
+		}
+		for perm, role := range perms {
+			if _, ok := permissionRoles[perm]; !ok {
+				return fmt.Errorf("таблица %s: неизвестное действие %q", table, perm)
+			}
+			if roleLevel(role) < 0 {
+				return fmt.Errorf("таблица %s: неизвестная роль %q", table, role)
+			}
+			if def := permissionRoles[perm]; roleLevel(role) < roleLevel(def) {
+				return fmt.Errorf("таблица %s: роль %s для %s ниже роли по умолчанию %s; переопределение может только ужесточать доступ", table, role, perm, def)
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigureTablePermissions задает правила доступа к отдельным таблицам
+func ConfigureTablePermissions(rules TablePermissions) error {
+	if err := ValidateTablePermissions(rules); err != nil {
+		return err
+	}
+	if rules == nil {
+		rules = TablePermissions{}
+	}
+	tablePermissions = rules
+	return nil
+}
+
+func roleLevel(role string) int {
+	for i, r := range roleOrder {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func validRole(role string) bool {
+	return roleLevel(role) >= 0
+}
+
+// Минимальная роль для действия над таблицей; пустая таблица - правило группы
+func requiredRole(perm Permission, table string) string {
+	if role, ok := tablePermissions[table][perm]; ok && table != "" {
+		return role
+	}
+	return permissionRoles[perm]
+}
+
+// Ответ 403 с описанием отказа
+func forbidden(c *gin.Context, perm Permission, role, required, table string) {
+	body := gin.H{
+		"error":        "Недостаточно прав",
+		"code":         "forbidden",
+		"permission":   perm,
+		"role":         role,
+		"requiredRole": required,
+	}
+	if table != "" {
+		body["table"] = table
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, body)
+}
+
+// Есть ли у текущего пользователя право; ответ клиенту не пишется
+func permitted(c *gin.Context, perm Permission, table string) bool {
+	return roleLevel(c.GetString(ctxUserRole)) >= roleLevel(requiredRole(perm, table))
+}
+
+// Проверяет право текущего пользователя; при отказе отвечает 403 и возвращает false
+func authorize(c *gin.Context, perm Permission, table string) bool {
+	if !permitted(c, perm, table) {
+		forbidden(c, perm, c.GetString(ctxUserRole), requiredRole(perm, table), table)
+		return false
+	}
+	return true
+}
+
+// Таблицы, которые текущий пользователь может читать
+func readableTables(c *gin.Context, tables []string) []string {
+	visible := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if permitted(c, PermRead, table) {
+			visible = append(visible, table)
+		}
+	}
+	return visible
+}
+
+// RequirePermission - middleware группы маршрутов, требующий права perm
+func RequirePermission(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorize(c, perm, "") {
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListUsersHandler возвращает пользователей и их роли
+func ListUsersHandler(c *gin.Context) {
+	var users []models.User
+	if err := database.DB.Order("id").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить пользователей"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "roles": roleOrder})
+}
+
+// SetUserRoleHandler меняет роль пользователя.
+// Новая роль действует с выдачи следующего access-токена: refresh
+// читает роль из БД, а access-токен живет не дольше maxAccessTTL.
+func SetUserRoleHandler(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестная роль", "roles": roleOrder})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+		return
+	}
+	if uint(id) == c.GetUint(ctxUserID) && req.Role != RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя понизить собственную роль"})
+		return
+	}
+
+	res := database.DB.Model(&models.User{}).Where("id = ?", id).Update("role", req.Role)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить роль"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "role": req.Role})
+}
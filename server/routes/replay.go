@@ -0,0 +1,581 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничения воспроизведения
+const (
+	replayPageSize = 1000
+	maxReplaySpeed = 1000.0
+	minReplaySpeed = 0.01
+
+	// Сколько завершенное воспроизведение хранится в реестре для запроса статуса
+	replayRetention = 10 * time.Minute
+)
+
+// Закрытый канал вместо таймера для отсчета, который уже пора отправлять:
+// остановка и команды проверяются перед каждой отправкой, даже при отставании
+var replayDueNow = func() chan time.Time {
+	ch := make(chan time.Time)
+	close(ch)
+	return ch
+}()
+
+// Числовые типы колонок, которые можно воспроизводить как каналы
+var numericColumnTypes = map[string]bool{
+	"smallint": true, "integer": true, "bigint": true,
+	"real": true, "double precision": true, "numeric": true,
+}
+
+// Параметры воспроизведения
+type ReplayConfig struct {
+	ID         string    `json:"id"`         // ID воспроизведения; по умолчанию chartId или случайный
+	ChartID    string    `json:"chartId"`    // ID графика для WebSocket рассылки
+	Table      string    `json:"table"`      // таблица с измерениями
+	TimeColumn string    `json:"timeColumn"` // колонка времени; по умолчанию measurement_time
+	Channels   []string  `json:"channels"`   // числовые колонки; по умолчанию current_value и voltage_value
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	Speed      float64   `json:"speed"` // 1 - реальное время, 10 - в 10 раз быстрее
+}
+
+// Команда управления воспроизведением
+type replayCommand struct {
+	action string // "pause", "resume", "seek", "speed"
+	seekTo time.Time
+	speed  float64
+}
+
+// Воспроизведение исторических данных как живого потока
+type replaySession struct {
+	cfg         ReplayConfig
+	hasOverload bool
+	textTime    bool   // время хранится строкой и требует приведения типа
+	keyColumn   string // второй ключ страниц при равном времени: id или ctid
+	commands    chan replayCommand
+	stop        chan struct{}
+	done        chan struct{}
+
+	mu       sync.Mutex
+	position time.Time // время последнего отправленного отсчета
+	speed    float64
+	paused   bool
+	finished bool
+	sent     uint64
+	err      string
+	endedAt  time.Time // время завершения цикла, для удаления из реестра
+}
+
+// Состояние воспроизведения для API
+type ReplayStatus struct {
+	ReplayConfig
+	Status   string    `json:"status"` // "playing", "paused", "finished", "failed"
+	Position time.Time `json:"position"`
+	Sent     uint64    `json:"sent"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func (r *replaySession) status() ReplayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := ReplayStatus{
+		ReplayConfig: r.cfg,
+		Status:       "playing",
+		Position:     r.position,
+		Sent:         r.sent,
+		Error:        r.err,
+	}
+	st.Speed = r.speed
+	switch {
+	case r.err != "":
+		st.Status = "failed"
+	case r.finished:
+		st.Status = "finished"
+	case r.paused:
+		st.Status = "paused"
+	}
+	return st
+}
+
+// Реестр воспроизведений
+var (
+	replaysMu sync.Mutex
+	replays   = make(map[string]*replaySession)
+)
+
+// Удаляет воспроизведения, завершенные раньше replayRetention.
+// Вызывается под replaysMu.
+func pruneReplays() {
+	for id, r := range replays {
+		r.mu.Lock()
+		expired := !r.endedAt.IsZero() && time.Since(r.endedAt) > replayRetention
+		r.mu.Unlock()
+		if expired {
+			delete(replays, id)
+		}
+	}
+}
+
+// Проверяет параметры и заполняет значения по умолчанию
+func (cfg *ReplayConfig) normalize() (hasOverload, textTime bool, keyColumn string, err error) {
+	if cfg.ID == "" {
+		cfg.ID = cfg.ChartID
+	}
+	if cfg.ID == "" {
+		cfg.ID = newSessionID()
+	}
+	if !sessionIDPattern.MatchString(cfg.ID) {
+		return false, false, "", fmt.Errorf("недопустимый ID воспроизведения: %q", cfg.ID)
+	}
+
+	if cfg.Speed == 0 {
+		cfg.Speed = 1
+	}
+	if cfg.Speed < minReplaySpeed || cfg.Speed > maxReplaySpeed {
+		return false, false, "", fmt.Errorf("speed должна быть в диапазоне %g..%g", minReplaySpeed, maxReplaySpeed)
+	}
+	if !cfg.EndTime.IsZero() && cfg.EndTime.Before(cfg.StartTime) {
+		return false, false, "", fmt.Errorf("endTime раньше startTime")
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = generationDefaults.Table
+	}
+	if cfg.TimeColumn == "" {
+		cfg.TimeColumn = "measurement_time"
+	}
+	if len(cfg.Channels) == 0 {
+		cfg.Channels = []string{"current_value", "voltage_value"}
+	}
+	for _, name := range append([]string{cfg.Table, cfg.TimeColumn}, cfg.Channels...) {
+		if !identifierPattern.MatchString(name) {
+			return false, false, "", fmt.Errorf("недопустимое имя: %q", name)
+		}
+	}
+
+	columns, err := getTableColumns(database.DB, cfg.Table)
+	if err != nil {
+		return false, false, "", err
+	}
+	if len(columns) == 0 {
+		return false, false, "", fmt.Errorf("таблица %q не найдена", cfg.Table)
+	}
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col.ColumnName] = col.DataType
+	}
+
+	timeType, ok := types[cfg.TimeColumn]
+	if !ok {
+		return false, false, "", fmt.Errorf("колонка %q не найдена", cfg.TimeColumn)
+	}
+	if !strings.HasPrefix(timeType, "timestamp") && timeType != "text" && timeType != "character varying" {
+		return false, false, "", fmt.Errorf("колонка %q не содержит время", cfg.TimeColumn)
+	}
+	for _, ch := range cfg.Channels {
+		if t, ok := types[ch]; !ok || !numericColumnTypes[t] {
+			return false, false, "", fmt.Errorf("колонка %q не найдена или не числовая", ch)
+		}
+	}
+
+	// Строки с одинаковым временем (например, разных цепей) упорядочиваются
+	// по id, а в таблицах без целочисленного id - по физическому адресу
+	keyColumn = "ctid"
+	if t := types["id"]; t == "integer" || t == "bigint" || t == "smallint" {
+		keyColumn = "id"
+	}
+
+	_, hasOverload = types["is_overload"]
+	return hasOverload, !strings.HasPrefix(timeType, "timestamp"), keyColumn, nil
+}
+
+// Тип сигнала для канала: current_value -> current
+func channelSignalType(column string) string {
+	return strings.TrimSuffix(column, "_value")
+}
+
+// Основной цикл воспроизведения
+func (r *replaySession) run() {
+	defer close(r.done)
+	defer func() {
+		r.mu.Lock()
+		r.endedAt = time.Now()
+		r.mu.Unlock()
+	}()
+
+	cfg := r.cfg
+	speed := cfg.Speed
+	paused := false
+
+	// Часы воспроизведения: отсчет с временем mediaAnchor отправляется в wallAnchor.
+	// Страницы читаются после (cursor, cursorKey); пустой cursorKey - с cursor включительно.
+	cursor := cfg.StartTime
+	cursorKey := ""
+	var mediaAnchor time.Time
+	wallAnchor := time.Now()
+
+	// Текущая позиция часов воспроизведения
+	clock := func() time.Time {
+		return mediaAnchor.Add(time.Duration(float64(time.Since(wallAnchor)) * speed))
+	}
+
+	for {
+		rows, err := r.fetchPage(cursor, cursorKey)
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		if len(rows) == 0 {
+			r.mu.Lock()
+			r.finished = true
+			r.mu.Unlock()
+			log.Printf("Воспроизведение %s завершено", cfg.ID)
+			return
+		}
+		if mediaAnchor.IsZero() {
+			mediaAnchor = rows[0].at
+		}
+
+		seeked := false
+		for _, row := range rows {
+			for {
+				var timer <-chan time.Time
+				if !paused {
+					due := wallAnchor.Add(time.Duration(float64(row.at.Sub(mediaAnchor)) / speed))
+					if wait := time.Until(due); wait > 0 {
+						timer = time.After(wait)
+					} else {
+						timer = replayDueNow
+					}
+				}
+
+				fired := false
+				select {
+				case <-r.stop:
+					return
+				case <-timer:
+					fired = true
+				case cmd := <-r.commands:
+					switch cmd.action {
+					case "pause":
+						if !paused {
+							paused = true
+							// Запоминаем позицию, чтобы продолжить с нее
+							mediaAnchor = clock()
+						}
+					case "resume":
+						if paused {
+							paused = false
+							wallAnchor = time.Now()
+						}
+					case "speed":
+						if !paused {
+							mediaAnchor, wallAnchor = clock(), time.Now()
+						}
+						speed = cmd.speed
+					case "seek":
+						cursor, cursorKey = cmd.seekTo, ""
+						mediaAnchor, wallAnchor = time.Time{}, time.Now()
+						seeked = true
+					}
+					r.mu.Lock()
+					r.paused = paused
+					r.mu.Unlock()
+				}
+				if seeked || fired {
+					break
+				}
+			}
+			if seeked {
+				break
+			}
+
+			r.emit(row)
+			cursor, cursorKey = row.at, row.key
+		}
+	}
+}
+
+// Строка исторических данных
+type replayRow struct {
+	at       time.Time
+	key      string // id или ctid в текстовом виде
+	values   []sql.NullFloat64
+	overload bool
+}
+
+// Читает очередную страницу строк, упорядоченных по времени и ключу:
+// строки после (after, afterKey), а при пустом afterKey - с after включительно
+func (r *replaySession) fetchPage(after time.Time, afterKey string) ([]replayRow, error) {
+	cfg := r.cfg
+	// Приведение только для текстовых колонок, иначе не работает индекс
+	timeExpr := fmt.Sprintf(`"%s"`, cfg.TimeColumn)
+	if r.textTime {
+		timeExpr += "::timestamptz"
+	}
+
+	keyType := "bigint"
+	if r.keyColumn == "ctid" {
+		keyType = "tid"
+	}
+	keyExpr := quoteIdentifier(r.keyColumn)
+
+	columns := []string{timeExpr, keyExpr + "::text"}
+	for _, ch := range cfg.Channels {
+		columns = append(columns, fmt.Sprintf(`"%s"::double precision`, ch))
+	}
+	if r.hasOverload {
+		columns = append(columns, `COALESCE("is_overload", false)`)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM "%s" WHERE %s >= ?`, strings.Join(columns, ", "), cfg.Table, timeExpr)
+	args := []interface{}{after}
+	if afterKey != "" {
+		query += fmt.Sprintf(" AND (%s, %s) > (?, CAST(? AS %s))", timeExpr, keyExpr, keyType)
+		args = append(args, after, afterKey)
+	}
+	if !cfg.EndTime.IsZero() {
+		query += fmt.Sprintf(" AND %s <= ?", timeExpr)
+		args = append(args, cfg.EndTime)
+	}
+	query += fmt.Sprintf(" ORDER BY %s, %s LIMIT %d", timeExpr, keyExpr, replayPageSize)
+
+	rows, err := database.DB.Raw(query, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []replayRow
+	for rows.Next() {
+		row := replayRow{values: make([]sql.NullFloat64, len(cfg.Channels))}
+		dest := []interface{}{&row.at, &row.key}
+		for i := range row.values {
+			dest = append(dest, &row.values[i])
+		}
+		if r.hasOverload {
+			dest = append(dest, &row.overload)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// Отправка строки через общий канал рассылки
+func (r *replaySession) emit(row replayRow) {
+	elapsed := 0.0
+	if !r.cfg.StartTime.IsZero() {
+		elapsed = row.at.Sub(r.cfg.StartTime).Seconds()
+	}
+
+	for i, ch := range r.cfg.Channels {
+		if !row.values[i].Valid {
+			continue
+		}
+		broadcast <- ChartData{
+			Type:      channelSignalType(ch),
+			Time:      elapsed,
+			Value:     row.values[i].Float64,
+			ChartID:   r.cfg.ChartID,
+			Timestamp: row.at,
+			Overload:  row.overload,
+		}
+	}
+
+	r.mu.Lock()
+	r.position = row.at
+	r.sent++
+	r.mu.Unlock()
+}
+
+func (r *replaySession) fail(err error) {
+	log.Printf("Ошибка воспроизведения %s: %v", r.cfg.ID, err)
+	r.mu.Lock()
+	r.err = err.Error()
+	r.mu.Unlock()
+}
+
+// Отправка команды в цикл воспроизведения
+func (r *replaySession) control(cmd replayCommand) bool {
+	select {
+	case r.commands <- cmd:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// StartReplayHandler запускает воспроизведение исторических данных
+func StartReplayHandler(c *gin.Context) {
+	var cfg ReplayConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if database.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Подключение к БД не инициализировано"})
+		return
+	}
+
+	hasOverload, textTime, keyColumn, err := cfg.normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(c, PermRead, cfg.Table) || !authorize(c, PermGenerate, cfg.Table) {
+		return
+	}
+
+	replaysMu.Lock()
+	pruneReplays()
+	if old, ok := replays[cfg.ID]; ok {
+		select {
+		case <-old.done:
+			// Завершенное воспроизведение можно заменить
+		default:
+			replaysMu.Unlock()
+			c.JSON(http.StatusConflict, gin.H{"error": "Воспроизведение уже запущено", "id": cfg.ID})
+			return
+		}
+	}
+	r := &replaySession{
+		cfg:         cfg,
+		hasOverload: hasOverload,
+		textTime:    textTime,
+		keyColumn:   keyColumn,
+		speed:       cfg.Speed,
+		commands:    make(chan replayCommand),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	replays[cfg.ID] = r
+	replaysMu.Unlock()
+
+	go r.run()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Воспроизведение запущено",
+		"replay":  r.status(),
+	})
+}
+
+func lookupReplay(c *gin.Context) (*replaySession, bool) {
+	replaysMu.Lock()
+	pruneReplays()
+	r, ok := replays[c.Param("id")]
+	replaysMu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Воспроизведение не найдено"})
+	}
+	return r, ok
+}
+
+// ListReplaysHandler возвращает все воспроизведения
+func ListReplaysHandler(c *gin.Context) {
+	replaysMu.Lock()
+	pruneReplays()
+	list := make([]ReplayStatus, 0, len(replays))
+	for _, r := range replays {
+		list = append(list, r.status())
+	}
+	replaysMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	c.JSON(http.StatusOK, gin.H{"replays": list, "count": len(list)})
+}
+
+// ReplayStatusHandler возвращает состояние воспроизведения
+func ReplayStatusHandler(c *gin.Context) {
+	if r, ok := lookupReplay(c); ok {
+		c.JSON(http.StatusOK, gin.H{"replay": r.status()})
+	}
+}
+
+// ControlReplayHandler обрабатывает pause, resume, seek и speed
+func ControlReplayHandler(c *gin.Context) {
+	r, ok := lookupReplay(c)
+	if !ok {
+		return
+	}
+
+	cmd := replayCommand{action: c.Param("action")}
+	switch cmd.action {
+	case "pause", "resume":
+	case "seek":
+		var request struct {
+			Time time.Time `json:"time" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cmd.seekTo = request.Time
+	case "speed":
+		var request struct {
+			Speed float64 `json:"speed" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.Speed < minReplaySpeed || request.Speed > maxReplaySpeed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("speed должна быть в диапазоне %g..%g", minReplaySpeed, maxReplaySpeed)})
+			return
+		}
+		cmd.speed = request.Speed
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Неизвестная команда: " + cmd.action})
+		return
+	}
+
+	if !r.control(cmd) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Воспроизведение уже завершено"})
+		return
+	}
+	if cmd.action == "speed" {
+		r.mu.Lock()
+		r.speed = cmd.speed
+		r.mu.Unlock()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replay": r.status()})
+}
+
+// StopReplayHandler останавливает и удаляет воспроизведение
+func StopReplayHandler(c *gin.Context) {
+	r, ok := lookupReplay(c)
+	if !ok {
+		return
+	}
+
+	replaysMu.Lock()
+	delete(replays, r.cfg.ID)
+	replaysMu.Unlock()
+
+	select {
+	case <-r.done:
+	default:
+		close(r.stop)
+		<-r.done
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Воспроизведение остановлено", "replay": r.status()})
+}
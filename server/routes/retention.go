@@ -0,0 +1,570 @@
+package routes
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Правило хранения: строки таблицы старше Keep удаляются.
+// Circuit ограничивает правило одной цепью (колонка circuit_id).
+type RetentionRule struct {
+	Table      string        `json:"table"`
+	Circuit    string        `json:"circuit,omitempty"`
+	TimeColumn string        `json:"timeColumn"` // по умолчанию measurement_time, для агрегатов - bucket
+	Keep       time.Duration `json:"keep"`
+	Archive    bool          `json:"archive"` // выгрузить строки в архив перед удалением
+}
+
+// Настройки задания хранения
+type RetentionConfig struct {
+	Interval   time.Duration // период запуска
+	BatchSize  int           // строк за одну транзакцию удаления
+	DryRun     bool          // только отчет, без удаления
+	ArchiveDir string        // каталог архива CSV.gz; пусто - архив отключен
+	Rules      []RetentionRule
+}
+
+// DefaultRetentionConfig возвращает настройки по умолчанию: правил нет
+func DefaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{Interval: time.Hour, BatchSize: 50000}
+}
+
+// Минимальный срок хранения - защита от опечатки в конфигурации
+const minRetentionKeep = time.Hour
+
+func (r *RetentionRule) normalize() {
+	if r.TimeColumn == "" {
+		r.TimeColumn = defaultTimeColumn(r.Table)
+	}
+}
+
+// ValidateRetentionConfig проверяет правила хранения
+func ValidateRetentionConfig(cfg RetentionConfig) error {
+	if cfg.Interval < time.Minute {
+		return fmt.Errorf("интервал не может быть меньше 1m")
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("размер пачки должен быть положительным")
+	}
+	for i, r := range cfg.Rules {
+		r.normalize()
+		if !identifierPattern.MatchString(r.Table) {
+			return fmt.Errorf("правило %d: недопустимое имя таблицы: %q", i, r.Table)
+		}
+		if isServiceTable(r.Table) && !isRollupTable(r.Table) {
+			return fmt.Errorf("правило %d: таблица %s не может очищаться по сроку", i, r.Table)
+		}
+		if !identifierPattern.MatchString(r.TimeColumn) {
+			return fmt.Errorf("правило %d: недопустимое имя колонки: %q", i, r.TimeColumn)
+		}
+		if r.Keep < minRetentionKeep {
+			return fmt.Errorf("правило %d: срок хранения не может быть меньше %s", i, minRetentionKeep)
+		}
+		if r.Archive && cfg.ArchiveDir == "" {
+			return fmt.Errorf("правило %d: для архива нужен archive_dir", i)
+		}
+	}
+	return nil
+}
+
+// Результат применения правила
+type RetentionRuleReport struct {
+	RetentionRule
+	Cutoff     time.Time `json:"cutoff"`
+	Rows       int64     `json:"rows"`       // удалено строк (в dry-run - будет удалено)
+	Partitions []string  `json:"partitions"` // удаленные секции целиком
+	Files      []string  `json:"files"`      // файлы архива
+	Error      string    `json:"error,omitempty"`
+}
+
+// Отчет о запуске задания
+type RetentionReport struct {
+	DryRun   bool                  `json:"dryRun"`
+	Started  time.Time             `json:"started"`
+	Finished time.Time             `json:"finished"`
+	Rules    []RetentionRuleReport `json:"rules"`
+}
+
+type retentionJob struct {
+	cfg RetentionConfig
+
+	running sync.Mutex // один запуск одновременно
+	mu      sync.Mutex
+	last    *RetentionReport
+}
+
+var retention = &retentionJob{cfg: DefaultRetentionConfig()}
+
+// ConfigureRetention задает правила хранения и запускает задание по расписанию
+func ConfigureRetention(db *gorm.DB, cfg RetentionConfig) error {
+	if err := ValidateRetentionConfig(cfg); err != nil {
+		return err
+	}
+	for i := range cfg.Rules {
+		cfg.Rules[i].normalize()
+	}
+	retention = &retentionJob{cfg: cfg}
+	if len(cfg.Rules) > 0 {
+		go retention.schedule(db)
+	}
+	return nil
+}
+
+func (j *retentionJob) schedule(db *gorm.DB) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !j.running.TryLock() {
+			continue
+		}
+		report := j.run(context.Background(), db, j.cfg.DryRun)
+		j.running.Unlock()
+		logRetentionReport(report)
+	}
+}
+
+func logRetentionReport(report *RetentionReport) {
+	for _, r := range report.Rules {
+		if r.Error != "" {
+			log.Printf("Хранение %s: ошибка: %s", r.Table, r.Error)
+			continue
+		}
+		if r.Rows > 0 || len(r.Partitions) > 0 {
+			action := "удалено"
+			if report.DryRun {
+				action = "будет удалено"
+			}
+			log.Printf("Хранение %s: %s строк: %d, секций: %d (до %s)",
+				r.Table, action, r.Rows, len(r.Partitions), r.Cutoff.Format(time.RFC3339))
+		}
+	}
+}
+
+// Применяет все правила; ошибка одного правила не останавливает остальные
+func (j *retentionJob) run(ctx context.Context, db *gorm.DB, dryRun bool) *RetentionReport {
+	report := &RetentionReport{DryRun: dryRun, Started: time.Now()}
+	for _, rule := range j.cfg.Rules {
+		r := RetentionRuleReport{
+			RetentionRule: rule,
+			Cutoff:        report.Started.Add(-rule.Keep).UTC(),
+			Partitions:    []string{},
+			Files:         []string{},
+		}
+		if err := j.apply(ctx, db, &r, dryRun); err != nil {
+			r.Error = err.Error()
+		}
+		report.Rules = append(report.Rules, r)
+	}
+	report.Finished = time.Now()
+
+	j.mu.Lock()
+	j.last = report
+	j.mu.Unlock()
+	return report
+}
+
+// Применяет одно правило: сначала целые секции, затем пачки строк
+func (j *retentionJob) apply(ctx context.Context, db *gorm.DB, r *RetentionRuleReport, dryRun bool) error {
+	columns, err := getTableColumns(db, r.Table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("таблица %s не найдена", r.Table)
+	}
+	hasColumn := func(name string) bool {
+		for _, col := range columns {
+			if col.ColumnName == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasColumn(r.TimeColumn) {
+		return fmt.Errorf("в таблице нет колонки %s", r.TimeColumn)
+	}
+	if r.Circuit != "" && !hasColumn("circuit_id") {
+		return fmt.Errorf("в таблице нет колонки circuit_id")
+	}
+
+	// Секции целиком старше срока удаляются без построчного DELETE;
+	// правило по цепи затрагивает только часть строк секции
+	var expired []string
+	if r.Circuit == "" {
+		partitions, err := expiredPartitions(db, r.Table, r.TimeColumn, r.Cutoff)
+		if err != nil {
+			return err
+		}
+		for _, p := range partitions {
+			n, file, err := j.dropPartition(ctx, r, p, dryRun)
+			if err != nil {
+				return fmt.Errorf("секция %s: %w", p, err)
+			}
+			r.Rows += n
+			r.Partitions = append(r.Partitions, p)
+			expired = append(expired, quoteIdentifier(p))
+			if file != "" {
+				r.Files = append(r.Files, file)
+			}
+		}
+	}
+
+	where := quoteIdentifier(r.TimeColumn) + " < $1"
+	args := []interface{}{r.Cutoff}
+	if r.Circuit != "" {
+		where += " AND circuit_id = $2"
+		args = append(args, r.Circuit)
+	}
+
+	if dryRun {
+		// В dry-run секции не удалены: их строки уже посчитаны выше
+		countWhere, countArgs := where, args
+		if len(expired) > 0 {
+			countWhere += fmt.Sprintf(" AND tableoid <> ALL($%d::text[]::regclass[])", len(args)+1)
+			countArgs = append(append([]interface{}{}, args...), expired)
+		}
+		var n int64
+		err := j.queryRow(ctx, "SELECT count(*) FROM "+quoteIdentifier(r.Table)+" WHERE "+countWhere, countArgs, &n)
+		r.Rows += n
+		return err
+	}
+
+	var archive *archiveFile
+	if r.Archive {
+		archive = newArchiveFile(j.cfg.ArchiveDir, r.Table, r.Circuit)
+		defer func() {
+			archive.close()
+			if archive.path != "" {
+				r.Files = append(r.Files, archive.path)
+			}
+		}()
+	}
+
+	// Пачка удаляется и выгружается в одной транзакции:
+	// транзакция фиксируется только после записи пачки на диск.
+	// Пачки берутся по возрастанию времени: с индексом по колонке времени
+	// каждая пачка читает только свой диапазон, а не всю таблицу заново.
+	query := fmt.Sprintf(`
+		DELETE FROM %[1]s WHERE (tableoid, ctid) IN (
+			SELECT tableoid, ctid FROM %[1]s WHERE %[2]s ORDER BY %[3]s LIMIT %[4]d
+		) RETURNING *`, quoteIdentifier(r.Table), where, quoteIdentifier(r.TimeColumn), j.cfg.BatchSize)
+	for {
+		n, err := j.deleteBatch(ctx, query, args, archive)
+		r.Rows += n
+		if err != nil {
+			return err
+		}
+		if n < int64(j.cfg.BatchSize) {
+			return nil
+		}
+	}
+}
+
+func (j *retentionJob) queryRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) error {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.QueryRowContext(ctx, query, args...).Scan(dest...)
+}
+
+func (j *retentionJob) deleteBatch(ctx context.Context, query string, args []interface{}, archive *archiveFile) (int64, error) {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := archive.write(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+	if err := archive.sync(); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// Отсоединяет секцию, выгружает ее в архив и удаляет.
+// DETACH выполняется отдельной короткой транзакцией: блокировка родительской
+// таблицы не держится, пока секция выгружается и удаляется.
+func (j *retentionJob) dropPartition(ctx context.Context, r *RetentionRuleReport, partition string, dryRun bool) (int64, string, error) {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return 0, "", err
+	}
+
+	if dryRun {
+		var n int64
+		err := sqlDB.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdentifier(partition)).Scan(&n)
+		return n, "", err
+	}
+
+	_, err = sqlDB.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s",
+		quoteIdentifier(r.Table), quoteIdentifier(partition)))
+	if err != nil {
+		return 0, "", err
+	}
+
+	n, path, err := j.exportAndDrop(ctx, r, partition)
+	if err != nil {
+		// Данные не потеряны: таблица осталась отдельной, ее нужно выгрузить вручную
+		return 0, "", fmt.Errorf("секция отсоединена, но не удалена: %w", err)
+	}
+	return n, path, nil
+}
+
+// Выгружает отсоединенную секцию и удаляет ее в одной транзакции:
+// таблица удаляется только после записи архива на диск
+func (j *retentionJob) exportAndDrop(ctx context.Context, r *RetentionRuleReport, table string) (int64, string, error) {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return 0, "", err
+	}
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var n int64
+	var path string
+	if r.Archive {
+		archive := newArchiveFile(j.cfg.ArchiveDir, r.Table, table)
+		defer archive.close()
+		rows, err := tx.QueryContext(ctx, "SELECT * FROM "+quoteIdentifier(table))
+		if err != nil {
+			return 0, "", err
+		}
+		n, err = archive.write(rows)
+		rows.Close()
+		if err == nil {
+			err = archive.sync()
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		path = archive.path
+	} else if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdentifier(table)).Scan(&n); err != nil {
+		return 0, "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DROP TABLE "+quoteIdentifier(table)); err != nil {
+		return 0, "", err
+	}
+	return n, path, tx.Commit()
+}
+
+// Секции таблицы, секционированной по диапазону timeColumn,
+// верхняя граница которых не позже cutoff
+func expiredPartitions(db *gorm.DB, table, timeColumn string, cutoff time.Time) ([]string, error) {
+	var partitions []struct {
+		Name   string
+		KeyDef string
+		TooOld bool
+	}
+	err := db.Raw(`
+		SELECT c.relname AS name,
+			pg_get_partkeydef(p.oid) AS key_def,
+			COALESCE(substring(pg_get_expr(c.relpartbound, c.oid) FROM 'TO \(''([^'']+)''\)')::timestamptz <= ?, false) AS too_old
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = p.relnamespace
+		WHERE n.nspname = 'public' AND p.relname = ? AND p.relkind = 'p'
+		ORDER BY c.relname
+	`, cutoff, table).Scan(&partitions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, p := range partitions {
+		if p.TooOld && p.KeyDef == fmt.Sprintf("RANGE (%s)", timeColumn) {
+			expired = append(expired, p.Name)
+		}
+	}
+	return expired, nil
+}
+
+// Файл архива: CSV со строкой заголовка, сжатый gzip.
+// Файл создается при записи первой строки: без удаленных строк архива нет.
+type archiveFile struct {
+	dir    string
+	table  string
+	suffix string
+	path   string // пусто, пока файл не создан
+	file   *os.File
+	gz     *gzip.Writer
+	csv    *csv.Writer
+}
+
+func newArchiveFile(dir, table, suffix string) *archiveFile {
+	if suffix == "" {
+		suffix = "all"
+	}
+	return &archiveFile{dir: dir, table: table, suffix: suffix}
+}
+
+// Создает файл и пишет строку заголовка
+func (a *archiveFile) open(columns []string) error {
+	if err := os.MkdirAll(filepath.Join(a.dir, a.table), 0o750); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s_%s.csv.gz", a.table, a.suffix, time.Now().UTC().Format("20060102T150405Z"))
+	path := filepath.Join(a.dir, a.table, name)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	a.path, a.file = path, f
+	a.gz = gzip.NewWriter(f)
+	a.csv = csv.NewWriter(a.gz)
+	return a.csv.Write(columns)
+}
+
+// Записывает строки результата; без архива только считает их
+func (a *archiveFile) write(rows *sql.Rows) (int64, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+
+	var n int64
+	for rows.Next() {
+		n++
+		if a == nil {
+			continue
+		}
+		if a.file == nil {
+			if err := a.open(columns); err != nil {
+				return n, err
+			}
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		for i, v := range values {
+			record[i] = archiveValue(v)
+		}
+		if err := a.csv.Write(record); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// Сбрасывает записанное на диск
+func (a *archiveFile) sync() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	a.csv.Flush()
+	if err := a.csv.Error(); err != nil {
+		return err
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *archiveFile) close() {
+	if a.file == nil {
+		return
+	}
+	if err := errors.Join(a.sync(), a.gz.Close(), a.file.Close()); err != nil {
+		log.Printf("Ошибка закрытия архива %s: %v", a.path, err)
+	}
+}
+
+func archiveValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// RetentionStatusHandler возвращает правила хранения и отчет последнего запуска
+func RetentionStatusHandler(c *gin.Context) {
+	retention.mu.Lock()
+	last := retention.last
+	retention.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules":      retention.cfg.Rules,
+		"interval":   retention.cfg.Interval.String(),
+		"dryRun":     retention.cfg.DryRun,
+		"archiveDir": retention.cfg.ArchiveDir,
+		"lastReport": last,
+	})
+}
+
+// RunRetentionHandler запускает задание немедленно.
+// {"dryRun": true} - только отчет о том, что будет удалено.
+func RunRetentionHandler(c *gin.Context) {
+	var req struct {
+		DryRun *bool `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dryRun := retention.cfg.DryRun
+	if req.DryRun != nil {
+		dryRun = *req.DryRun
+	}
+	if len(retention.cfg.Rules) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Правила хранения не заданы"})
+		return
+	}
+
+	if !retention.running.TryLock() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Задание хранения уже выполняется"})
+		return
+	}
+	defer retention.running.Unlock()
+
+	report := retention.run(c.Request.Context(), database.DB, dryRun)
+	logRetentionReport(report)
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Таблица сырых измерений, для которой ведутся агрегаты
+const rollupSourceTable = "current_measurements"
+
+// Каналы агрегатов и соответствующие колонки сырой таблицы
+var rollupChannels = map[string]string{
+	"current_value": "current",
+	"voltage_value": "voltage",
+}
+
+// Уровень агрегации
+type rollupLevel struct {
+	Name  string
+	Table string
+	Step  time.Duration
+}
+
+// Уровни от мелкого к крупному; каждый считается из предыдущего
+var rollupLevels = []rollupLevel{
+	{Name: "1s", Table: "measurement_rollups_1s", Step: time.Second},
+	{Name: "1m", Table: "measurement_rollups_1m", Step: time.Minute},
+	{Name: "15m", Table: "measurement_rollups_15m", Step: 15 * time.Minute},
+}
+
+// Настройки фонового расчета агрегатов
+type RollupConfig struct {
+	Enabled   bool
+	Interval  time.Duration // пауза между проходами, когда очередь пуста
+	BatchSize int           // интервалов 1 с (по цепям) за одну транзакцию
+}
+
+// DefaultRollupConfig возвращает настройки по умолчанию
+func DefaultRollupConfig() RollupConfig {
+	return RollupConfig{Enabled: true, Interval: 5 * time.Second, BatchSize: 10000}
+}
+
+// ValidateRollupConfig проверяет настройки агрегатов
+func ValidateRollupConfig(cfg RollupConfig) error {
+	if cfg.Interval < 100*time.Millisecond {
+		return fmt.Errorf("интервал не может быть меньше 100ms")
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("размер пачки должен быть положительным")
+	}
+	return nil
+}
+
+// Состояние расчета для статуса
+type RollupStats struct {
+	Enabled   bool       `json:"enabled"`
+	MaxTime   *time.Time `json:"maxTime,omitempty"` // начало последнего рассчитанного интервала 1 с
+	Processed uint64     `json:"processed"`         // пересчитано интервалов 1 с с запуска
+	LastRun   time.Time  `json:"lastRun"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+type rollupWorker struct {
+	cfg RollupConfig
+
+	mu    sync.Mutex
+	stats RollupStats
+}
+
+var rollups = &rollupWorker{cfg: DefaultRollupConfig()}
+
+// ConfigureRollups задает настройки и запускает фоновый расчет агрегатов.
+// Триггер current_measurements ставит в очередь rollup_dirty_buckets интервалы,
+// в которые попали новые или измененные строки; отметка фиксируется вместе
+// со строкой, поэтому запоздавшие измерения и долгие транзакции тоже
+// учитываются. Расчет забирает интервалы из очереди пачками.
+func ConfigureRollups(db *gorm.DB, cfg RollupConfig) error {
+	if err := ValidateRollupConfig(cfg); err != nil {
+		return err
+	}
+	rollups = &rollupWorker{cfg: cfg, stats: RollupStats{Enabled: cfg.Enabled}}
+	if cfg.Enabled {
+		go rollups.run(db)
+	}
+	return nil
+}
+
+func (w *rollupWorker) run(db *gorm.DB) {
+	for {
+		processed, err := w.step(db)
+		if err != nil {
+			log.Printf("Ошибка расчета агрегатов: %v", err)
+		}
+		// Пачка заполнена целиком - сразу берем следующую
+		if err == nil && processed == w.cfg.BatchSize {
+			continue
+		}
+		time.Sleep(w.cfg.Interval)
+	}
+}
+
+// Пересчитывает очередную пачку интервалов из очереди; возвращает их число
+func (w *rollupWorker) step(db *gorm.DB) (int, error) {
+	var maxTime *time.Time
+	var processed int
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`CREATE TEMP TABLE rollup_dirty (bucket timestamptz, circuit_id text) ON COMMIT DROP`).Error
+		if err != nil {
+			return err
+		}
+		// Отметки, которые держит еще не зафиксированная транзакция с новыми
+		// строками, пропускаются и будут забраны следующим проходом.
+		// Параллельный экземпляр сервера забирает другие отметки.
+		res := tx.Exec(`
+			WITH picked AS (
+				DELETE FROM rollup_dirty_buckets WHERE (bucket, circuit_id) IN (
+					SELECT bucket, circuit_id FROM rollup_dirty_buckets
+					ORDER BY bucket LIMIT ? FOR UPDATE SKIP LOCKED
+				) RETURNING bucket, circuit_id
+			)
+			INSERT INTO rollup_dirty SELECT bucket, circuit_id FROM picked`, w.cfg.BatchSize)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		processed = int(res.RowsAffected)
+
+		if err := tx.Exec(rollupFromRawSQL(rollupLevels[0])).Error; err != nil {
+			return fmt.Errorf("уровень %s: %w", rollupLevels[0].Name, err)
+		}
+		for i := 1; i < len(rollupLevels); i++ {
+			if err := tx.Exec(rollupFromLevelSQL(rollupLevels[i-1], rollupLevels[i])).Error; err != nil {
+				return fmt.Errorf("уровень %s: %w", rollupLevels[i].Name, err)
+			}
+		}
+
+		return tx.Raw(`
+			INSERT INTO rollup_state (source_table, max_time, updated_at)
+			SELECT ?, max(bucket), now() FROM rollup_dirty
+			ON CONFLICT (source_table) DO UPDATE SET
+				max_time = GREATEST(rollup_state.max_time, EXCLUDED.max_time),
+				updated_at = now()
+			RETURNING max_time`, rollupSourceTable).Scan(&maxTime).Error
+	})
+
+	w.mu.Lock()
+	w.stats.LastRun = time.Now()
+	if err != nil {
+		w.stats.LastError = err.Error()
+	} else {
+		w.stats.LastError = ""
+		if maxTime != nil {
+			w.stats.MaxTime = maxTime
+		}
+		w.stats.Processed += uint64(processed)
+	}
+	w.mu.Unlock()
+	return processed, err
+}
+
+func (w *rollupWorker) snapshot() RollupStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Начало интервала длины step, в который попадает время col.
+// Не зависит от часового пояса сессии: секунды отсекаются одинаково в любом
+// поясе, а date_bin отсчитывает интервалы от начала 2000 года по UTC.
+func bucketExpr(col string, step time.Duration) string {
+	if step == time.Second {
+		return fmt.Sprintf("date_trunc('second', %s)", col)
+	}
+	return fmt.Sprintf("date_bin(interval '%d seconds', %s, timestamptz '2000-01-01 00:00:00+00')", int64(step/time.Second), col)
+}
+
+// Колонки агрегата и обновление при повторном расчете интервала
+const rollupColumns = `(bucket, circuit_id, channel, count, min, max, avg, rms, sum, sum_sq)`
+
+const rollupUpsert = `
+	ON CONFLICT (circuit_id, channel, bucket) DO UPDATE SET
+		count = EXCLUDED.count, min = EXCLUDED.min, max = EXCLUDED.max,
+		avg = EXCLUDED.avg, rms = EXCLUDED.rms,
+		sum = EXCLUDED.sum, sum_sq = EXCLUDED.sum_sq`
+
+// Пересчет затронутых интервалов первого уровня из сырых строк
+func rollupFromRawSQL(level rollupLevel) string {
+	values := ""
+	for _, col := range sortedKeys(rollupChannels) {
+		if values != "" {
+			values += ", "
+		}
+		values += fmt.Sprintf("('%s', m.%s::float8)", rollupChannels[col], quoteIdentifier(col))
+	}
+
+	return fmt.Sprintf(`
+		INSERT INTO %s %s
+		SELECT d.bucket, d.circuit_id, ch.channel,
+			count(*), min(ch.v), max(ch.v), avg(ch.v), sqrt(avg(ch.v * ch.v)),
+			sum(ch.v), sum(ch.v * ch.v)
+		FROM rollup_dirty d
+		JOIN %s m
+			ON (m.circuit_id = d.circuit_id OR (m.circuit_id IS NULL AND d.circuit_id = ''))
+			AND m.measurement_time >= d.bucket
+			AND m.measurement_time < d.bucket + interval '%d seconds'
+		CROSS JOIN LATERAL (VALUES %s) AS ch(channel, v)
+		WHERE ch.v IS NOT NULL
+		GROUP BY d.bucket, d.circuit_id, ch.channel
+		%s`,
+		quoteIdentifier(level.Table), rollupColumns, quoteIdentifier(rollupSourceTable),
+		int64(level.Step/time.Second), values, rollupUpsert)
+}
+
+// Пересчет затронутых интервалов уровня to из уровня from
+func rollupFromLevelSQL(from, to rollupLevel) string {
+	return fmt.Sprintf(`
+		INSERT INTO %s %s
+		SELECT d.bucket, d.circuit_id, s.channel,
+			sum(s.count), min(s.min), max(s.max),
+			sum(s.sum) / sum(s.count), sqrt(sum(s.sum_sq) / sum(s.count)),
+			sum(s.sum), sum(s.sum_sq)
+		FROM (SELECT DISTINCT %s AS bucket, circuit_id FROM rollup_dirty) d
+		JOIN %s s
+			ON s.circuit_id = d.circuit_id
+			AND s.bucket >= d.bucket
+			AND s.bucket < d.bucket + interval '%d seconds'
+		GROUP BY d.bucket, d.circuit_id, s.channel
+		%s`,
+		quoteIdentifier(to.Table), rollupColumns, bucketExpr("bucket", to.Step),
+		quoteIdentifier(from.Table), int64(to.Step/time.Second), rollupUpsert)
+}
@@ -0,0 +1,623 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Размер страницы GET /tables/:tableName/rows
+const (
+	defaultRowsPageSize = 100
+	maxRowsPageSize     = 1000
+)
+
+// Параметры строки запроса, которые не являются фильтрами
+var rowsReservedParams = map[string]bool{"sort": true, "limit": true, "offset": true, "total": true}
+
+// Режимы подсчета total в GET /tables/:tableName/rows
+const (
+	rowsTotalEstimate = "estimate" // оценка планировщика, без чтения таблицы
+	rowsTotalExact    = "exact"    // count(*), читает все подходящие строки
+	rowsTotalNone     = "none"     // total не возвращается
+)
+
+// Операторы фильтра ?col=op:value
+var rowsFilterOps = map[string]string{
+	"eq":    "=",
+	"ne":    "<>",
+	"lt":    "<",
+	"lte":   "<=",
+	"gt":    ">",
+	"gte":   ">=",
+	"like":  "LIKE",
+	"ilike": "ILIKE",
+	"in":    "IN",
+	"is":    "IS",
+}
+
+// Описание таблицы для операций со строками
+type rowsTable struct {
+	name       string
+	columns    map[string]ColumnInfo
+	order      []string // колонки в порядке таблицы
+	primaryKey []string
+}
+
+// Загружает описание таблицы из information_schema. Таблица должна быть
+// доступна для операций с данными. При ошибке отвечает клиенту.
+func loadRowsTable(c *gin.Context) (*rowsTable, bool) {
+	name := c.Param("tableName")
+
+	tables, err := allowedTables()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tables list: " + err.Error()})
+		return nil, false
+	}
+	if !containsString(tables, name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Таблица не найдена: " + name})
+		return nil, false
+	}
+
+	columns, err := getTableColumns(database.DB, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch table metadata: " + err.Error()})
+		return nil, false
+	}
+	primaryKey, err := getPrimaryKey(database.DB, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch table metadata: " + err.Error()})
+		return nil, false
+	}
+
+	t := &rowsTable{name: name, columns: make(map[string]ColumnInfo, len(columns)), primaryKey: primaryKey}
+	for _, col := range columns {
+		t.columns[col.ColumnName] = col
+		t.order = append(t.order, col.ColumnName)
+	}
+	return t, true
+}
+
+// Аргументы запроса с плейсхолдерами $n
+type sqlArgs []interface{}
+
+func (a *sqlArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// Значения первичного ключа из сегмента пути. Для ключа из одной колонки
+// сегмент - само значение (запятые и другие символы допустимы, если
+// закодированы в URL). Составной ключ передается JSON-массивом значений
+// в порядке колонок ключа: /rows/%5B1%2C%222024-01-01T00%3A00%3A00Z%22%5D
+func (t *rowsTable) pkValues(raw string) ([]interface{}, error) {
+	if len(t.primaryKey) == 0 {
+		return nil, fmt.Errorf("у таблицы %s нет первичного ключа", t.name)
+	}
+	if len(t.primaryKey) == 1 {
+		return []interface{}{raw}, nil
+	}
+
+	var values []interface{}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil || decoder.More() {
+		return nil, fmt.Errorf("составной ключ передается JSON-массивом значений (%s)", strings.Join(t.primaryKey, ", "))
+	}
+	if len(values) != len(t.primaryKey) {
+		return nil, fmt.Errorf("ожидается значений ключа: %d (%s)", len(t.primaryKey), strings.Join(t.primaryKey, ", "))
+	}
+	return values, nil
+}
+
+// Условие WHERE по первичному ключу из пути
+func (t *rowsTable) pkCondition(raw string, args *sqlArgs) (string, error) {
+	values, err := t.pkValues(raw)
+	if err != nil {
+		return "", err
+	}
+
+	conds := make([]string, len(values))
+	for i, name := range t.primaryKey {
+		v, err := coerceColumnValue(t.columns[name], values[i])
+		if err != nil {
+			return "", err
+		}
+		conds[i] = quoteIdentifier(name) + " = " + args.add(v)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// Условия WHERE из фильтров ?col=op:value; без оператора - равенство.
+// Несколько фильтров объединяются через AND.
+func (t *rowsTable) filterConditions(query map[string][]string, args *sqlArgs) ([]string, error) {
+	var conds []string
+	for _, name := range sortedKeys(query) {
+		if rowsReservedParams[name] {
+			continue
+		}
+		col, ok := t.columns[name]
+		if !ok {
+			return nil, fmt.Errorf("неизвестная колонка фильтра: %s", name)
+		}
+
+		for _, raw := range query[name] {
+			op, value := "eq", raw
+			if prefix, rest, found := strings.Cut(raw, ":"); found {
+				if _, known := rowsFilterOps[prefix]; known {
+					op, value = prefix, rest
+				}
+			}
+			column := quoteIdentifier(name)
+
+			switch op {
+			case "is":
+				switch strings.ToLower(value) {
+				case "null":
+					conds = append(conds, column+" IS NULL")
+				case "notnull":
+					conds = append(conds, column+" IS NOT NULL")
+				default:
+					return nil, fmt.Errorf("фильтр %s: для is допустимо null или notnull", name)
+				}
+			case "like", "ilike":
+				conds = append(conds, column+"::text "+rowsFilterOps[op]+" "+args.add(value))
+			case "in":
+				items := strings.Split(value, ",")
+				placeholders := make([]string, len(items))
+				for i, item := range items {
+					v, err := coerceColumnValue(col, item)
+					if err != nil {
+						return nil, fmt.Errorf("фильтр %s: %v", name, err)
+					}
+					placeholders[i] = args.add(v)
+				}
+				conds = append(conds, column+" IN ("+strings.Join(placeholders, ", ")+")")
+			default:
+				v, err := coerceColumnValue(col, value)
+				if err != nil {
+					return nil, fmt.Errorf("фильтр %s: %v", name, err)
+				}
+				conds = append(conds, column+" "+rowsFilterOps[op]+" "+args.add(v))
+			}
+		}
+	}
+	return conds, nil
+}
+
+// ORDER BY из ?sort=col,-col; по умолчанию - по первичному ключу
+func (t *rowsTable) orderBy(spec string) (string, error) {
+	if spec == "" {
+		if len(t.primaryKey) == 0 {
+			return "", nil
+		}
+		keys := make([]string, len(t.primaryKey))
+		for i, name := range t.primaryKey {
+			keys[i] = quoteIdentifier(name)
+		}
+		return " ORDER BY " + strings.Join(keys, ", "), nil
+	}
+
+	var keys []string
+	for _, item := range strings.Split(spec, ",") {
+		name, dir := strings.TrimSpace(item), "ASC"
+		if rest, ok := strings.CutPrefix(name, "-"); ok {
+			name, dir = rest, "DESC"
+		}
+		if _, ok := t.columns[name]; !ok {
+			return "", fmt.Errorf("неизвестная колонка сортировки: %s", name)
+		}
+		keys = append(keys, quoteIdentifier(name)+" "+dir)
+	}
+	return " ORDER BY " + strings.Join(keys, ", "), nil
+}
+
+// Колонки и значения из тела запроса, приведенные к типам колонок
+func (t *rowsTable) bodyValues(c *gin.Context) ([]string, []interface{}, bool) {
+	var body map[string]interface{}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный JSON: " + err.Error()})
+		return nil, nil, false
+	}
+	if len(body) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не переданы значения колонок"})
+		return nil, nil, false
+	}
+
+	names := sortedKeys(body)
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		col, ok := t.columns[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестная колонка: " + name})
+			return nil, nil, false
+		}
+		v, err := coerceColumnValue(col, body[name])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "column": name})
+			return nil, nil, false
+		}
+		values[i] = v
+	}
+	return names, values, true
+}
+
+// Приводит значение из JSON или строки запроса к типу колонки (data_type
+// из information_schema). Для неизвестных типов строка передается как есть,
+// разбор выполняет PostgreSQL.
+func coerceColumnValue(col ColumnInfo, v interface{}) (interface{}, error) {
+	name := col.ColumnName
+	if v == nil {
+		if col.IsNullable != "YES" {
+			return nil, fmt.Errorf("колонка %s не допускает NULL", name)
+		}
+		return nil, nil
+	}
+
+	switch col.DataType {
+	case "smallint", "integer", "bigint":
+		bits := map[string]int{"smallint": 16, "integer": 32, "bigint": 64}[col.DataType]
+		s, ok := numberText(v)
+		if !ok {
+			return nil, fmt.Errorf("колонка %s: ожидается целое число", name)
+		}
+		n, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("колонка %s: ожидается целое число типа %s", name, col.DataType)
+		}
+		return n, nil
+
+	case "real", "double precision":
+		s, ok := numberText(v)
+		if !ok {
+			return nil, fmt.Errorf("колонка %s: ожидается число", name)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("колонка %s: ожидается число", name)
+		}
+		return f, nil
+
+	case "numeric":
+		// Передается текстом, чтобы не терять точность
+		s, ok := numberText(v)
+		if !ok {
+			return nil, fmt.Errorf("колонка %s: ожидается число", name)
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("колонка %s: ожидается число", name)
+		}
+		return s, nil
+
+	case "boolean":
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("колонка %s: ожидается true или false", name)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("колонка %s: ожидается true или false", name)
+
+	case "timestamp with time zone":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("колонка %s: ожидается время в формате RFC 3339", name)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("колонка %s: ожидается время в формате RFC 3339", name)
+		}
+		return ts, nil
+
+	case "json", "jsonb":
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("колонка %s: %v", name, err)
+		}
+		return json.RawMessage(raw), nil
+
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("колонка %s: ожидается строка для типа %s", name, col.DataType)
+		}
+		return s, nil
+	}
+}
+
+// Текст числа из JSON (json.Number) или строки запроса
+func numberText(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case json.Number:
+		return val.String(), true
+	case string:
+		return strings.TrimSpace(val), true
+	}
+	return "", false
+}
+
+// Ключи в порядке сортировки, чтобы номера параметров не зависели от обхода map
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Список колонок для SELECT/RETURNING
+func (t *rowsTable) selectList() string {
+	cols := make([]string, len(t.order))
+	for i, name := range t.order {
+		cols[i] = quoteIdentifier(name)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// Оценка числа строк запроса по плану EXPLAIN: не читает таблицу,
+// поэтому не зависит от ее размера
+func estimateRows(ctx context.Context, from string, args sqlArgs) (int64, error) {
+	result, err := runReadOnlyQuery(ctx, "EXPLAIN (FORMAT JSON) SELECT 1"+from, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Rows) == 0 || len(result.Columns) == 0 {
+		return 0, fmt.Errorf("пустой план запроса")
+	}
+
+	// pgx возвращает план json уже разобранным; приводим к структуре через JSON
+	raw, err := json.Marshal(result.Rows[0][result.Columns[0]])
+	if err != nil {
+		return 0, err
+	}
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return 0, err
+	}
+	if len(plan) == 0 {
+		return 0, fmt.Errorf("пустой план запроса")
+	}
+	return int64(plan[0].Plan.Rows), nil
+}
+
+// ListRowsHandler возвращает строки таблицы с фильтрами, сортировкой и пагинацией:
+// GET /tables/:tableName/rows?col=op:value&sort=-col&limit=100&offset=0&total=estimate
+//
+// total=estimate (по умолчанию) - оценка планировщика, total=exact - точный
+// count(*), который на больших таблицах читает их целиком, total=none - без total.
+func ListRowsHandler(c *gin.Context) {
+	t, ok := loadRowsTable(c)
+	if !ok || !authorize(c, PermRead, t.name) {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRowsPageSize)))
+	if err != nil || limit < 1 || limit > maxRowsPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit должен быть от 1 до %d", maxRowsPageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset должен быть неотрицательным"})
+		return
+	}
+	totalMode := c.DefaultQuery("total", rowsTotalEstimate)
+	if totalMode != rowsTotalEstimate && totalMode != rowsTotalExact && totalMode != rowsTotalNone {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "total должен быть estimate, exact или none"})
+		return
+	}
+
+	var args sqlArgs
+	conds, err := t.filterConditions(c.Request.URL.Query(), &args)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := t.orderBy(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	from := " FROM " + quoteIdentifier(t.name) + where
+
+	query := "SELECT " + t.selectList() + from + order + fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	result, err := runReadOnlyQuery(c.Request.Context(), query, args...)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"table":      t.name,
+		"primaryKey": t.primaryKey,
+		"data":       result.Rows,
+		"count":      len(result.Rows),
+		"limit":      limit,
+		"offset":     offset,
+	}
+
+	switch totalMode {
+	case rowsTotalExact:
+		total, err := runReadOnlyQuery(c.Request.Context(), "SELECT count(*) AS total"+from, args...)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		response["total"] = total.Rows[0]["total"]
+		response["totalEstimated"] = false
+	case rowsTotalEstimate:
+		total, err := estimateRows(c.Request.Context(), from, args)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		// Оценка не может быть меньше уже прочитанного
+		if seen := int64(offset + len(result.Rows)); total < seen {
+			total = seen
+		}
+		response["total"] = total
+		response["totalEstimated"] = true
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetRowHandler возвращает строку по первичному ключу
+func GetRowHandler(c *gin.Context) {
+	t, ok := loadRowsTable(c)
+	if !ok || !authorize(c, PermRead, t.name) {
+		return
+	}
+
+	var args sqlArgs
+	cond, err := t.pkCondition(c.Param("pk"), &args)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := "SELECT " + t.selectList() + " FROM " + quoteIdentifier(t.name) + " WHERE " + cond
+	result, err := runReadOnlyQuery(c.Request.Context(), query, args...)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if len(result.Rows) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Строка не найдена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result.Rows[0]})
+}
+
+// CreateRowHandler добавляет строку; тело - объект {колонка: значение}
+func CreateRowHandler(c *gin.Context) {
+	t, ok := loadRowsTable(c)
+	if !ok || !authorize(c, PermEditRows, t.name) {
+		return
+	}
+
+	names, values, ok := t.bodyValues(c)
+	if !ok {
+		return
+	}
+
+	var args sqlArgs
+	cols := make([]string, len(names))
+	placeholders := make([]string, len(names))
+	for i, name := range names {
+		cols[i] = quoteIdentifier(name)
+		placeholders[i] = args.add(values[i])
+	}
+
+	query := "INSERT INTO " + quoteIdentifier(t.name) +
+		" (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")" +
+		" RETURNING " + t.selectList()
+	result, err := runQuery(c.Request.Context(), false, query, args...)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Строка добавлена",
+		"data":    result.Rows[0],
+	})
+}
+
+// UpdateRowHandler изменяет переданные колонки строки с первичным ключом pk
+func UpdateRowHandler(c *gin.Context) {
+	t, ok := loadRowsTable(c)
+	if !ok || !authorize(c, PermEditRows, t.name) {
+		return
+	}
+
+	names, values, ok := t.bodyValues(c)
+	if !ok {
+		return
+	}
+
+	var args sqlArgs
+	sets := make([]string, len(names))
+	for i, name := range names {
+		sets[i] = quoteIdentifier(name) + " = " + args.add(values[i])
+	}
+	cond, err := t.pkCondition(c.Param("pk"), &args)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := "UPDATE " + quoteIdentifier(t.name) + " SET " + strings.Join(sets, ", ") +
+		" WHERE " + cond + " RETURNING " + t.selectList()
+	result, err := runQuery(c.Request.Context(), false, query, args...)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if len(result.Rows) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Строка не найдена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Строка обновлена",
+		"data":    result.Rows[0],
+	})
+}
+
+// DeleteRowHandler удаляет строку с первичным ключом pk
+func DeleteRowHandler(c *gin.Context) {
+	t, ok := loadRowsTable(c)
+	if !ok || !authorize(c, PermEditRows, t.name) {
+		return
+	}
+
+	var args sqlArgs
+	cond, err := t.pkCondition(c.Param("pk"), &args)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := "DELETE FROM " + quoteIdentifier(t.name) + " WHERE " + cond + " RETURNING " + t.selectList()
+	result, err := runQuery(c.Request.Context(), false, query, args...)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if len(result.Rows) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Строка не найдена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Строка удалена",
+		"data":    result.Rows[0],
+	})
+}
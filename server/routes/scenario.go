@@ -0,0 +1,204 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+)
+
+// Виды событий сценария
+const (
+	EventSag                = "sag"                 // провал напряжения
+	EventSwell              = "swell"               // перенапряжение
+	EventInterruption       = "interruption"        // перерыв питания
+	EventGroundFault        = "slg_fault"           // однофазное КЗ на землю
+	EventFrequencyDrift     = "frequency_drift"     // линейный дрейф частоты
+	EventOscillatory        = "oscillatory"         // затухающий колебательный переходный процесс
+	EventCapacitorSwitching = "capacitor_switching" // коммутация конденсаторной батареи
+)
+
+// Максимальное число событий в сценарии
+const maxScenarioEvents = 64
+
+// Перегрузка: огибающая канала с учетом событий выше номинальной
+// амплитуды (с гармониками) более чем в overloadRatio раз
+const overloadRatio = 1.2
+
+// Событие сценария генерации.
+// Смысл Magnitude зависит от вида события:
+//   - sag, swell, interruption: множитель переменной составляющей напряжения
+//   - slg_fault: кратность тока поврежденной фазы
+//   - frequency_drift: отклонение частоты в конце нарастания, Гц
+//   - oscillatory, capacitor_switching: начальная амплитуда колебаний в долях от амплитуды сигнала
+type ScenarioEvent struct {
+	Kind      string  `json:"kind"`
+	Start     float64 `json:"start"`               // начало, секунды от запуска сессии
+	Duration  float64 `json:"duration"`            // длительность, секунды
+	Magnitude float64 `json:"magnitude"`           // см. описание выше; 0 - значение по умолчанию
+	Phase     string  `json:"phase,omitempty"`     // "a", "b", "c"; пусто - все фазы
+	Residual  float64 `json:"residual,omitempty"`  // slg_fault: остаточное напряжение поврежденной фазы
+	Frequency float64 `json:"frequency,omitempty"` // частота колебаний переходного процесса, Гц
+	Damping   float64 `json:"damping,omitempty"`   // коэффициент затухания, 1/с
+}
+
+// Заполняет значения по умолчанию и проверяет событие
+func (e *ScenarioEvent) normalize() error {
+	if e.Start < 0 {
+		return fmt.Errorf("start не может быть отрицательным")
+	}
+	if e.Duration <= 0 {
+		return fmt.Errorf("duration должна быть положительной")
+	}
+	if e.Magnitude < 0 && e.Kind != EventFrequencyDrift {
+		return fmt.Errorf("magnitude не может быть отрицательной")
+	}
+	if e.Phase != "" && !containsString(phaseNames, e.Phase) {
+		return fmt.Errorf("неизвестная фаза: %q", e.Phase)
+	}
+	if e.Residual < 0 || e.Frequency < 0 || e.Damping < 0 {
+		return fmt.Errorf("residual, frequency и damping не могут быть отрицательными")
+	}
+
+	switch e.Kind {
+	case EventSag:
+		setDefault(&e.Magnitude, 0.5)
+	case EventSwell:
+		setDefault(&e.Magnitude, 1.2)
+	case EventInterruption:
+		// Magnitude 0 - полное отсутствие напряжения
+	case EventGroundFault:
+		setDefault(&e.Magnitude, 5)
+		setDefault(&e.Residual, 0.2)
+		if e.Phase == "" {
+			e.Phase = "a"
+		}
+	case EventFrequencyDrift:
+		if e.Magnitude == 0 {
+			return fmt.Errorf("для frequency_drift нужно задать magnitude в Гц")
+		}
+	case EventOscillatory:
+		setDefault(&e.Magnitude, 0.5)
+		setDefault(&e.Frequency, 500)
+		setDefault(&e.Damping, 5/e.Duration)
+	case EventCapacitorSwitching:
+		setDefault(&e.Magnitude, 0.8)
+		setDefault(&e.Frequency, 600)
+		setDefault(&e.Damping, 5/e.Duration)
+	case "":
+		return fmt.Errorf("не указан вид события")
+	default:
+		return fmt.Errorf("неизвестный вид события: %q", e.Kind)
+	}
+	return nil
+}
+
+func setDefault(v *float64, def float64) {
+	if *v == 0 {
+		*v = def
+	}
+}
+
+func normalizeScenario(events []ScenarioEvent) error {
+	if len(events) > maxScenarioEvents {
+		return fmt.Errorf("не более %d событий", maxScenarioEvents)
+	}
+	for i := range events {
+		if err := events[i].normalize(); err != nil {
+			return fmt.Errorf("событие %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Наибольшее суммарное повышение частоты от событий дрейфа, Гц
+func scenarioDrift(events []ScenarioEvent) float64 {
+	var drift float64
+	for _, e := range events {
+		if e.Kind == EventFrequencyDrift && e.Magnitude > 0 {
+			drift += e.Magnitude
+		}
+	}
+	return drift
+}
+
+func (e ScenarioEvent) active(t float64) bool {
+	return t >= e.Start && t < e.Start+e.Duration
+}
+
+// Затрагивает ли событие канал
+func (e ScenarioEvent) affects(ch waveformChannel) bool {
+	return e.Phase == "" || ch.phaseName == "" || e.Phase == ch.phaseName
+}
+
+// Дополнительный набег фазы от событий дрейфа частоты.
+// Отклонение частоты нарастает линейно за время события и затем снимается,
+// поэтому фаза остается непрерывной.
+func (g *waveformGenerator) driftPhase(t float64) float64 {
+	var phase float64
+	for _, e := range g.events {
+		if e.Kind != EventFrequencyDrift || t < e.Start {
+			continue
+		}
+		tau := math.Min(t-e.Start, e.Duration)
+		phase += 2 * math.Pi * e.Magnitude * tau * tau / (2 * e.Duration)
+	}
+	return phase
+}
+
+// Применяет активные события к переменной составляющей канала.
+// Возвращает новое значение и признак перегрузки, который определяется
+// по огибающей (а не мгновенному значению) для событий любого вида.
+func (g *waveformGenerator) applyEvents(ch waveformChannel, t, ac float64) (float64, bool) {
+	amplitude := ch.signal.Amplitude
+
+	// Номинальная огибающая, ее множитель и добавка колебательных процессов
+	peak := amplitude
+	for _, h := range ch.signal.Harmonics {
+		peak += amplitude * h.Magnitude
+	}
+	gain, burst := 1.0, 0.0
+
+	for _, e := range g.events {
+		if !e.active(t) || !e.affects(ch) {
+			continue
+		}
+		tau := t - e.Start
+
+		switch e.Kind {
+		case EventSag, EventSwell:
+			if ch.kind == "voltage" {
+				ac *= e.Magnitude
+				gain *= e.Magnitude
+			}
+		case EventInterruption:
+			ac *= e.Magnitude
+			gain *= e.Magnitude
+		case EventGroundFault:
+			if ch.kind == "current" {
+				ac *= e.Magnitude
+				gain *= e.Magnitude
+			} else {
+				ac *= e.Residual
+				gain *= e.Residual
+			}
+		case EventOscillatory:
+			if ch.kind == "voltage" {
+				ac += dampedOscillation(amplitude*e.Magnitude, e.Frequency, e.Damping, tau)
+				burst += amplitude * e.Magnitude * math.Exp(-e.Damping*tau)
+			}
+		case EventCapacitorSwitching:
+			// Колебательный всплеск напряжения и бросок тока заряда батареи
+			scale := e.Magnitude
+			if ch.kind == "current" {
+				scale *= 2
+			}
+			ac += dampedOscillation(amplitude*scale, e.Frequency, e.Damping, tau)
+			burst += amplitude * scale * math.Exp(-e.Damping*tau)
+		}
+	}
+	overload := peak > 0 && peak*gain+burst > overloadRatio*peak
+	return ac, overload
+}
+
+func dampedOscillation(amplitude, frequency, damping, tau float64) float64 {
+	return amplitude * math.Exp(-damping*tau) * math.Cos(2*math.Pi*frequency*tau)
+}
@@ -0,0 +1,490 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Методы прореживания ряда
+const (
+	seriesLTTB   = "lttb"   // Largest-Triangle-Three-Buckets: сохраняет форму кривой
+	seriesMinMax = "minmax" // минимум и максимум каждого интервала: сохраняет все пики
+)
+
+// Ограничения GET /series
+const (
+	defaultSeriesPoints = 1000
+	minSeriesPoints     = 10
+	maxSeriesPoints     = 20000
+	defaultSeriesRange  = time.Hour
+)
+
+// Точка прореженного ряда
+type SeriesPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Типы колонок, пригодные для времени и значений ряда
+var (
+	seriesTimeTypes  = []string{"timestamp with time zone", "timestamp without time zone"}
+	seriesValueTypes = []string{"smallint", "integer", "bigint", "real", "double precision", "numeric"}
+)
+
+// SeriesHandler возвращает прореженный ряд для графика:
+// GET /series?table=&timeColumn=&columns=a,b&start=&end=&points=&method=lttb|minmax
+// points - число точек на ряд (обычно ширина графика в пикселях).
+// Строки читаются потоком, в памяти держатся только текущие интервалы.
+// Если точность позволяет, используется самый крупный подходящий агрегат.
+func SeriesHandler(c *gin.Context) {
+	var request struct {
+		measurementFilter
+		TimeColumn string `form:"timeColumn"`
+		Columns    string `form:"columns"`
+		Start      string `form:"start"`
+		End        string `form:"end"`
+		Points     int    `form:"points"`
+		Method     string `form:"method"`
+	}
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.TimeColumn == "" {
+		request.TimeColumn = "measurement_time"
+	}
+	if request.Columns == "" {
+		request.Columns = "current_value,voltage_value"
+	}
+	if request.Points == 0 {
+		request.Points = defaultSeriesPoints
+	}
+	if request.Points < minSeriesPoints || request.Points > maxSeriesPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("points должен быть от %d до %d", minSeriesPoints, maxSeriesPoints)})
+		return
+	}
+	if request.Method == "" {
+		request.Method = seriesMinMax
+	}
+	if request.Method != seriesLTTB && request.Method != seriesMinMax {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method должен быть lttb или minmax"})
+		return
+	}
+
+	end := time.Now()
+	if request.End != "" {
+		t, err := time.Parse(time.RFC3339Nano, request.End)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат end"})
+			return
+		}
+		end = t
+	}
+	start := end.Add(-defaultSeriesRange)
+	if request.Start != "" {
+		t, err := time.Parse(time.RFC3339Nano, request.Start)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат start"})
+			return
+		}
+		start = t
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end должен быть позже start"})
+		return
+	}
+
+	dbQuery, ok := request.query(c)
+	if !ok {
+		return
+	}
+
+	// Колонки проверяются по information_schema
+	columns, err := getTableColumns(database.DB, request.Table)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch table metadata: " + err.Error()})
+		return
+	}
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col.ColumnName] = col.DataType
+	}
+	if !containsString(seriesTimeTypes, types[request.TimeColumn]) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Колонка времени не найдена или не является timestamp: " + request.TimeColumn})
+		return
+	}
+	valueColumns := strings.Split(request.Columns, ",")
+	for i, name := range valueColumns {
+		name = strings.TrimSpace(name)
+		if !containsString(seriesValueTypes, types[name]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Колонка значений не найдена или не числовая: " + name})
+			return
+		}
+		valueColumns[i] = name
+	}
+	if (request.CircuitID != "" && types["circuit_id"] == "") || (request.SensorModel != "" && types["sensor_model"] == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "В таблице нет колонок circuit_id/sensor_model для фильтра"})
+		return
+	}
+
+	samplers := make([]seriesSampler, len(valueColumns))
+	for i := range samplers {
+		samplers[i] = newSeriesSampler(request.Method, start, end, request.Points)
+	}
+
+	// Крупные диапазоны берутся из агрегатов, хвост после последнего
+	// рассчитанного интервала - из сырых строк
+	source, rawFrom := "raw", start
+	level, coverEnd, useRollup := chooseRollup(request.measurementFilter, request.TimeColumn, valueColumns,
+		start, end, seriesResolution(request.Method, start, end, request.Points))
+	var scanned int
+	if useRollup {
+		n, err := feedRollup(c, level, request.CircuitID, valueColumns, start, coverEnd, samplers)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		scanned += n
+		source, rawFrom = "rollup_"+level.Name, coverEnd
+	}
+	if rawFrom.Before(end) {
+		n, err := feedRaw(c, dbQuery, request.TimeColumn, valueColumns, rawFrom, end, samplers)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		scanned += n
+	}
+
+	series := make(map[string][]SeriesPoint, len(valueColumns))
+	for i, name := range valueColumns {
+		series[name] = samplers[i].result()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"table":      request.Table,
+		"timeColumn": request.TimeColumn,
+		"method":     request.Method,
+		"start":      start,
+		"end":        end,
+		"points":     request.Points,
+		"rows":       scanned,
+		"source":     source,
+		"series":     series,
+	})
+}
+
+// Прореживание ряда, получающего точки по возрастанию времени
+type seriesSampler interface {
+	add(p SeriesPoint)
+	result() []SeriesPoint
+}
+
+func newSeriesSampler(method string, start, end time.Time, points int) seriesSampler {
+	if method == seriesLTTB {
+		// Первая и последняя точки выдаются отдельно
+		return &lttbSampler{buckets: newTimeBuckets(start, end, points-2), current: -1}
+	}
+	// На интервал приходится две точки: минимум и максимум
+	return &minMaxSampler{buckets: newTimeBuckets(start, end, points/2), bucket: -1}
+}
+
+// Разбиение диапазона времени на равные интервалы
+type timeBuckets struct {
+	start time.Time
+	width float64 // в наносекундах
+	count int
+}
+
+func newTimeBuckets(start, end time.Time, count int) timeBuckets {
+	return timeBuckets{start: start, width: float64(end.Sub(start)) / float64(count), count: count}
+}
+
+func (b timeBuckets) index(t time.Time) int {
+	i := int(float64(t.Sub(b.start)) / b.width)
+	if i < 0 {
+		return 0
+	}
+	if i >= b.count {
+		return b.count - 1
+	}
+	return i
+}
+
+// Минимум и максимум каждого интервала в порядке их появления.
+// Ни один выброс не пропадает при любом масштабе.
+type minMaxSampler struct {
+	buckets  timeBuckets
+	bucket   int
+	min, max SeriesPoint
+	out      []SeriesPoint
+}
+
+func (s *minMaxSampler) add(p SeriesPoint) {
+	i := s.buckets.index(p.Time)
+	if i != s.bucket {
+		s.flush()
+		s.bucket, s.min, s.max = i, p, p
+		return
+	}
+	if p.Value < s.min.Value {
+		s.min = p
+	}
+	if p.Value > s.max.Value {
+		s.max = p
+	}
+}
+
+func (s *minMaxSampler) flush() {
+	if s.bucket < 0 {
+		return
+	}
+	first, second := s.min, s.max
+	if second.Time.Before(first.Time) {
+		first, second = second, first
+	}
+	s.out = append(s.out, first)
+	if second != first {
+		s.out = append(s.out, second)
+	}
+}
+
+func (s *minMaxSampler) result() []SeriesPoint {
+	s.flush()
+	s.bucket = -1
+	if s.out == nil {
+		return []SeriesPoint{}
+	}
+	return s.out
+}
+
+// LTTB по интервалам времени. Из каждого интервала выбирается точка,
+// образующая треугольник наибольшей площади с выбранной точкой предыдущего
+// интервала и средней точкой следующего. В памяти - два интервала.
+type lttbSampler struct {
+	buckets timeBuckets
+	first   *SeriesPoint
+	last    SeriesPoint
+	pending []SeriesPoint // интервал, ожидающий выбора точки
+	filling []SeriesPoint // заполняемый следующий интервал
+	current int           // номер заполняемого интервала
+	out     []SeriesPoint
+}
+
+func (s *lttbSampler) add(p SeriesPoint) {
+	if s.first == nil {
+		s.first = &p
+		s.out = append(s.out, p)
+	}
+	s.last = p
+
+	i := s.buckets.index(p.Time)
+	if i != s.current {
+		if len(s.filling) > 0 {
+			s.selectPending(average(s.filling))
+			s.pending, s.filling = s.filling, nil
+		}
+		s.current = i
+	}
+	s.filling = append(s.filling, p)
+}
+
+// Выбирает точку интервала pending по средней точке следующего интервала
+func (s *lttbSampler) selectPending(next SeriesPoint) {
+	if len(s.pending) == 0 {
+		return
+	}
+	// Координаты относительно точки a, чтобы не терять точность на UnixNano
+	a := s.out[len(s.out)-1]
+	cx, cy := float64(next.Time.Sub(a.Time)), next.Value-a.Value
+
+	best, bestArea := s.pending[0], -1.0
+	for _, p := range s.pending {
+		px, py := float64(p.Time.Sub(a.Time)), p.Value-a.Value
+		area := math.Abs(cx*py - px*cy)
+		if area > bestArea {
+			best, bestArea = p, area
+		}
+	}
+	if best != a {
+		s.out = append(s.out, best)
+	}
+}
+
+func (s *lttbSampler) result() []SeriesPoint {
+	if s.first == nil {
+		return []SeriesPoint{}
+	}
+	if len(s.filling) > 0 {
+		s.selectPending(average(s.filling))
+		s.pending, s.filling = s.filling, nil
+	}
+	s.selectPending(s.last)
+	if s.out[len(s.out)-1] != s.last {
+		s.out = append(s.out, s.last)
+	}
+	sort.SliceStable(s.out, func(i, j int) bool { return s.out[i].Time.Before(s.out[j].Time) })
+	return s.out
+}
+
+// Средняя точка интервала
+func average(points []SeriesPoint) SeriesPoint {
+	var t, v float64
+	for _, p := range points {
+		t += float64(p.Time.Sub(points[0].Time))
+		v += p.Value
+	}
+	n := float64(len(points))
+	return SeriesPoint{Time: points[0].Time.Add(time.Duration(t / n)), Value: v / n}
+}
+
+// Ширина интервала, которую дает прореживание до points точек
+func seriesResolution(method string, start, end time.Time, points int) time.Duration {
+	buckets := points / 2
+	if method == seriesLTTB {
+		buckets = points - 2
+	}
+	return end.Sub(start) / time.Duration(buckets)
+}
+
+// Выбирает самый крупный уровень агрегатов, интервал которого не больше
+// resolution. Агрегаты есть только для measurement_time и каналов
+// current_measurements по цепям, поэтому фильтр по модели датчика требует
+// сырых строк. coverEnd - начало первого не полностью рассчитанного интервала.
+func chooseRollup(f measurementFilter, timeColumn string, valueColumns []string, start, end time.Time, resolution time.Duration) (level rollupLevel, coverEnd time.Time, ok bool) {
+	if !rollups.cfg.Enabled || f.Table != rollupSourceTable || timeColumn != "measurement_time" || f.SensorModel != "" {
+		return level, coverEnd, false
+	}
+	for _, col := range valueColumns {
+		if _, ok := rollupChannels[col]; !ok {
+			return level, coverEnd, false
+		}
+	}
+
+	found := false
+	for _, l := range rollupLevels {
+		if l.Step <= resolution {
+			level, found = l, true
+		}
+	}
+	if !found {
+		return level, coverEnd, false
+	}
+
+	// Рассчитано все до последнего интервала, кроме еще стоящих в очереди.
+	// Очередь хранит интервалы 1 с; интервал уровня не готов, если в очереди
+	// любая его секунда, поэтому учитываются отметки с начала интервала
+	// уровня, в который попадает start, и только по запрошенной цепи.
+	dirty := database.DB.Table("rollup_dirty_buckets").Select("min(bucket)").
+		Where("bucket >= ? AND bucket < ?", start.Truncate(level.Step), end)
+	if f.CircuitID != "" {
+		dirty = dirty.Where("circuit_id = ?", f.CircuitID)
+	}
+	var maxTime *time.Time
+	err := database.DB.Raw(`
+		SELECT LEAST(max_time, (?))
+		FROM rollup_state WHERE source_table = ?`, dirty, rollupSourceTable).
+		Scan(&maxTime).Error
+	if err != nil || maxTime == nil {
+		return level, coverEnd, false
+	}
+	coverEnd = maxTime.Truncate(level.Step)
+	if !coverEnd.After(start) {
+		return level, coverEnd, false
+	}
+	if coverEnd.After(end) {
+		coverEnd = end
+	}
+	return level, coverEnd, true
+}
+
+// Передает в samplers минимум и максимум каждого интервала агрегатов из [from, to)
+func feedRollup(c *gin.Context, level rollupLevel, circuitID string, valueColumns []string, from, to time.Time, samplers []seriesSampler) (int, error) {
+	index := make(map[string]int, len(valueColumns))
+	channels := make([]string, len(valueColumns))
+	for i, col := range valueColumns {
+		index[rollupChannels[col]] = i
+		channels[i] = rollupChannels[col]
+	}
+
+	dbQuery := database.DB.WithContext(c.Request.Context()).Table(level.Table).
+		Select("bucket, channel, min, max").
+		Where("bucket >= ? AND bucket < ? AND channel IN ?", from, to, channels)
+	if circuitID != "" {
+		dbQuery = dbQuery.Where("circuit_id = ?", circuitID)
+	}
+	rows, err := dbQuery.Order("bucket").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var scanned int
+	for rows.Next() {
+		var bucket time.Time
+		var channel string
+		var min, max float64
+		if err := rows.Scan(&bucket, &channel, &min, &max); err != nil {
+			return scanned, err
+		}
+		scanned++
+		s := samplers[index[channel]]
+		s.add(SeriesPoint{Time: bucket, Value: min})
+		if max != min {
+			s.add(SeriesPoint{Time: bucket, Value: max})
+		}
+	}
+	return scanned, rows.Err()
+}
+
+// Передает в samplers сырые строки из [from, to) потоком
+func feedRaw(c *gin.Context, dbQuery *gorm.DB, timeColumn string, valueColumns []string, from, to time.Time, samplers []seriesSampler) (int, error) {
+	selectList := make([]string, 0, len(valueColumns)+1)
+	selectList = append(selectList, quoteIdentifier(timeColumn))
+	for _, name := range valueColumns {
+		selectList = append(selectList, quoteIdentifier(name))
+	}
+	column := quoteIdentifier(timeColumn)
+
+	rows, err := dbQuery.WithContext(c.Request.Context()).
+		Select(strings.Join(selectList, ", ")).
+		Where(column+" >= ? AND "+column+" < ?", from, to).
+		Order(column).
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var scanned int
+	var t time.Time
+	values := make([]sql.NullFloat64, len(valueColumns))
+	dest := make([]interface{}, len(valueColumns)+1)
+	dest[0] = &t
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return scanned, err
+		}
+		scanned++
+		for i, v := range values {
+			if v.Valid && !math.IsNaN(v.Float64) {
+				samplers[i].add(SeriesPoint{Time: t, Value: v.Float64})
+			}
+		}
+	}
+	return scanned, rows.Err()
+}
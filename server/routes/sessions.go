@@ -0,0 +1,355 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ID сессии старого API /generation/start
+const defaultSessionID = "default"
+
+// Параметры генерации по умолчанию для сессий, где они не заданы
+type GenerationDefaults struct {
+	Interval    int    // мс
+	Table       string // таблица для измерений
+	CircuitID   string
+	SensorModel string
+}
+
+var generationDefaults = GenerationDefaults{
+	Interval:    20,
+	Table:       "current_measurements",
+	CircuitID:   "circuit_B",
+	SensorModel: "I-Sensor-Pro",
+}
+
+// ValidateGenerationDefaults проверяет параметры генерации по умолчанию
+func ValidateGenerationDefaults(d GenerationDefaults) error {
+	if d.Interval < minGenerationInterval || d.Interval > maxGenerationInterval {
+		return fmt.Errorf("interval должен быть в диапазоне %d..%d мс", minGenerationInterval, maxGenerationInterval)
+	}
+	if !identifierPattern.MatchString(d.Table) {
+		return fmt.Errorf("недопустимое имя таблицы: %q", d.Table)
+	}
+	if d.CircuitID == "" || d.SensorModel == "" {
+		return fmt.Errorf("circuit_id и sensor_model не могут быть пустыми")
+	}
+	return nil
+}
+
+// ConfigureGeneration задает параметры генерации по умолчанию.
+// Вызывается при старте сервера.
+func ConfigureGeneration(d GenerationDefaults) error {
+	if err := ValidateGenerationDefaults(d); err != nil {
+		return err
+	}
+	generationDefaults = d
+	return nil
+}
+
+// Ограничения частоты выдачи и дискретизации
+const (
+	minGenerationInterval = 1       // мс
+	maxGenerationInterval = 60000   // мс
+	maxSampleRate         = 50000.0 // Гц
+	maxBlockSamples       = 10000   // отсчетов за один тик
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Параметры сессии генерации
+type SessionConfig struct {
+	ID          string  `json:"id"`          // ID сессии; по умолчанию chartId или случайный
+	ChartID     string  `json:"chartId"`     // ID графика для WebSocket рассылки
+	Interval    int     `json:"interval"`    // период выдачи блоков отсчетов, мс
+	SampleRate  float64 `json:"sampleRate"`  // частота дискретизации, Гц; по умолчанию 1000/interval
+	Table       string  `json:"table"`       // таблица для сохранения измерений
+	CircuitID   string  `json:"circuitId"`   // circuit_id записываемых строк
+	SensorModel string  `json:"sensorModel"` // sensor_model записываемых строк
+
+	Waveform *WaveformSpec   `json:"waveform,omitempty"` // описание сигналов; по умолчанию прежние синусоиды
+	Scenario []ScenarioEvent `json:"scenario,omitempty"` // события, накладываемые на сигналы
+}
+
+// Сессия генерации со своим жизненным циклом
+type generationSession struct {
+	cfg       SessionConfig
+	startedAt time.Time
+	stop      chan struct{}
+	done      chan struct{}
+
+	samples atomic.Uint64
+}
+
+// Состояние сессии для API. Ошибки записи общие для всех сессий:
+// они в статистике writer (GET /generation/status)
+type SessionStatus struct {
+	SessionConfig
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"startedAt"`
+	Samples   uint64    `json:"samples"`
+}
+
+func (s *generationSession) status() SessionStatus {
+	st := SessionStatus{
+		SessionConfig: s.cfg,
+		Status:        "running",
+		StartedAt:     s.startedAt,
+		Samples:       s.samples.Load(),
+	}
+	select {
+	case <-s.done:
+		st.Status = "stopped"
+	default:
+	}
+	return st
+}
+
+// Реестр сессий генерации
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*generationSession
+}
+
+var sessions = &sessionRegistry{sessions: make(map[string]*generationSession)}
+
+// Ошибка конфликта при запуске сессии с занятым ID
+var errSessionExists = fmt.Errorf("сессия уже запущена")
+
+func (r *sessionRegistry) start(cfg SessionConfig) (*generationSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[cfg.ID]; ok {
+		return nil, errSessionExists
+	}
+
+	s := &generationSession{
+		cfg:       cfg,
+		startedAt: time.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	r.sessions[cfg.ID] = s
+
+	go func() {
+		defer close(s.done)
+		generateSineWaveData(s)
+	}()
+	return s, nil
+}
+
+// Останавливает сессию и удаляет ее из реестра
+func (r *sessionRegistry) stop(id string) (*generationSession, bool) {
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	if ok {
+		delete(r.sessions, id)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		close(s.stop)
+		<-s.done
+	}
+	return s, ok
+}
+
+func (r *sessionRegistry) get(id string) (*generationSession, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+func (r *sessionRegistry) list() []SessionStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]SessionStatus, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		result = append(result, s.status())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Заполняет значения по умолчанию и проверяет параметры сессии
+func (cfg *SessionConfig) normalize() error {
+	if cfg.ID == "" {
+		cfg.ID = cfg.ChartID
+	}
+	if cfg.ID == "" {
+		cfg.ID = newSessionID()
+	}
+	if !sessionIDPattern.MatchString(cfg.ID) {
+		return fmt.Errorf("недопустимый ID сессии: %q", cfg.ID)
+	}
+
+	if cfg.Interval == 0 {
+		cfg.Interval = generationDefaults.Interval
+	}
+	if cfg.Interval < minGenerationInterval || cfg.Interval > maxGenerationInterval {
+		return fmt.Errorf("interval должен быть в диапазоне %d..%d мс", minGenerationInterval, maxGenerationInterval)
+	}
+
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = 1000 / float64(cfg.Interval)
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > maxSampleRate {
+		return fmt.Errorf("sampleRate должна быть в диапазоне 0..%g Гц", maxSampleRate)
+	}
+	if cfg.SampleRate*float64(cfg.Interval)/1000 > maxBlockSamples {
+		return fmt.Errorf("более %d отсчетов за interval: уменьшите interval или sampleRate", maxBlockSamples)
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = generationDefaults.Table
+	}
+	if !identifierPattern.MatchString(cfg.Table) {
+		return fmt.Errorf("недопустимое имя таблицы: %q", cfg.Table)
+	}
+	tables, err := getTables(database.DB)
+	if err != nil {
+		return err
+	}
+	if !containsString(tables, cfg.Table) {
+		return fmt.Errorf("таблица %q не найдена", cfg.Table)
+	}
+
+	if cfg.CircuitID == "" {
+		cfg.CircuitID = generationDefaults.CircuitID
+	}
+	if cfg.SensorModel == "" {
+		cfg.SensorModel = generationDefaults.SensorModel
+	}
+
+	if cfg.Waveform == nil {
+		spec := defaultWaveformSpec()
+		cfg.Waveform = &spec
+	}
+	if err := cfg.Waveform.normalize(); err != nil {
+		return fmt.Errorf("waveform: %w", err)
+	}
+	if err := normalizeScenario(cfg.Scenario); err != nil {
+		return fmt.Errorf("scenario: %w", err)
+	}
+
+	// Частоты сигналов (с учетом дрейфа) и колебаний переходных процессов
+	// должны быть ниже частоты Найквиста, иначе сигнал искажается наложением
+	if f := cfg.Waveform.maxFrequency(scenarioDrift(cfg.Scenario)); f >= cfg.SampleRate/2 {
+		return fmt.Errorf("частота сигнала %g Гц не ниже половины sampleRate (%g Гц)", f, cfg.SampleRate)
+	}
+	for i, e := range cfg.Scenario {
+		if e.Frequency >= cfg.SampleRate/2 {
+			return fmt.Errorf("scenario: событие %d (%s): частота колебаний %g Гц не ниже половины sampleRate (%g Гц)",
+				i, e.Kind, e.Frequency, cfg.SampleRate)
+		}
+	}
+	return nil
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Запуск сессии и ответ клиенту; общий для нового и старого API
+func startSession(c *gin.Context, cfg SessionConfig) {
+	if database.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Подключение к БД не инициализировано",
+		})
+		return
+	}
+
+	if err := cfg.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(c, PermGenerate, cfg.Table) {
+		return
+	}
+
+	s, err := sessions.start(cfg)
+	if err == errSessionExists {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Генерация уже запущена",
+			"id":    cfg.ID,
+		})
+		return
+	}
+
+	st := s.status()
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Генерация синусоиды запущена",
+		"status":   st.Status,
+		"interval": st.Interval,
+		"session":  st,
+	})
+}
+
+// CreateSessionHandler запускает новую сессию генерации
+func CreateSessionHandler(c *gin.Context) {
+	var cfg SessionConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startSession(c, cfg)
+}
+
+// ListSessionsHandler возвращает все запущенные сессии
+func ListSessionsHandler(c *gin.Context) {
+	list := sessions.list()
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": list,
+		"count":    len(list),
+	})
+}
+
+// SessionStatusHandler возвращает статус одной сессии
+func SessionStatusHandler(c *gin.Context) {
+	s, ok := sessions.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сессия не найдена"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session": s.status()})
+}
+
+// DeleteSessionHandler останавливает и удаляет сессию
+func DeleteSessionHandler(c *gin.Context) {
+	s, ok := sessions.stop(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сессия не найдена"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Генерация данных остановлена",
+		"status":  "stopped",
+		"session": s.status(),
+	})
+}
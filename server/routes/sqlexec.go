@@ -0,0 +1,222 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"EPS/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Клиент закрыл соединение до ответа (соглашение nginx)
+const statusClientClosedRequest = 499
+
+// Коды ошибок PostgreSQL
+const (
+	pgQueryCanceled           = "57014" // отмена по statement_timeout
+	pgReadOnlySQLTransaction  = "25006" // изменение данных в READ ONLY транзакции
+	pgInsufficientPrivilege   = "42501"
+	pgClassDataException      = "22" // неверное значение или формат
+	pgClassIntegrityViolation = "23" // NOT NULL, UNIQUE, FOREIGN KEY, CHECK
+	maxQueryStatementTimeout  = 10 * time.Minute
+	maxQueryRows              = 1_000_000
+	queryContextTimeoutMargin = time.Second // запас контекста сверх statement_timeout
+)
+
+// Результат пользовательского запроса
+type queryResult struct {
+	Columns      []string
+	Types        []string // типы колонок PostgreSQL
+	Rows         []map[string]interface{}
+	Truncated    bool // строк больше MaxRows, возвращены первые MaxRows
+	RowsAffected int64
+}
+
+// Выполняет SELECT в транзакции READ ONLY с statement_timeout и ограничением
+// числа строк. Запрос отменяется вместе с ctx (например, при закрытии
+// соединения клиентом). Если задана роль, транзакция выполняется от ее имени.
+func runReadOnlyQuery(ctx context.Context, query string, args ...interface{}) (*queryResult, error) {
+	return runQuery(ctx, true, query, args...)
+}
+
+// Выполняет запрос через pgx в отдельной транзакции. Параметры $n передаются
+// серверу отдельно от текста запроса. Изменяющая транзакция фиксируется,
+// только читающая - откатывается.
+func runQuery(ctx context.Context, readOnly bool, query string, args ...interface{}) (*queryResult, error) {
+	limits := sqlLimits
+
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, limits.StatementTimeout+queryContextTimeoutMargin)
+	defer cancel()
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var result *queryResult
+	err = conn.Raw(func(driverConn interface{}) error {
+		pg := driverConn.(*stdlib.Conn).Conn()
+
+		mode := pgx.ReadWrite
+		if readOnly {
+			mode = pgx.ReadOnly
+		}
+		tx, err := pg.BeginTx(ctx, pgx.TxOptions{AccessMode: mode})
+		if err != nil {
+			return err
+		}
+		// После отмены ctx откат должен дойти до сервера
+		defer tx.Rollback(context.Background())
+
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", limits.StatementTimeout.Milliseconds())); err != nil {
+			return err
+		}
+		if readOnly && limits.Role != "" {
+			if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+quoteIdentifier(limits.Role)); err != nil {
+				return err
+			}
+		}
+
+		result, err = collectRows(ctx, tx, pg.TypeMap(), limits.MaxRows, query, args)
+		if err != nil {
+			return err
+		}
+		if readOnly {
+			return nil
+		}
+		return tx.Commit(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Читает не больше maxRows строк результата
+func collectRows(ctx context.Context, tx pgx.Tx, types *pgtype.Map, maxRows int, query string, args []interface{}) (*queryResult, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	result := &queryResult{
+		Columns: make([]string, len(fields)),
+		Types:   make([]string, len(fields)),
+		Rows:    []map[string]interface{}{},
+	}
+	for i, f := range fields {
+		result.Columns[i] = f.Name
+		if t, ok := types.TypeForOID(f.DataTypeOID); ok {
+			result.Types[i] = t.Name
+		} else {
+			result.Types[i] = fmt.Sprintf("oid:%d", f.DataTypeOID)
+		}
+	}
+
+	for rows.Next() {
+		if len(result.Rows) >= maxRows {
+			result.Truncated = true
+			break
+		}
+
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		rowMap := make(map[string]interface{}, len(fields))
+		for i, col := range result.Columns {
+			rowMap[col] = jsonValue(values[i])
+		}
+		result.Rows = append(result.Rows, rowMap)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.RowsAffected = rows.CommandTag().RowsAffected()
+	return result, nil
+}
+
+// Приводит значение pgx к виду, понятному клиенту в JSON
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", val[0:4], val[4:6], val[6:8], val[8:10], val[10:16])
+	case pgtype.Numeric:
+		if f, err := val.Float64Value(); err == nil && f.Valid {
+			return f.Float64
+		}
+		return nil
+	default:
+		return v
+	}
+}
+
+// Ответ на ошибку выполнения пользовательского запроса
+func respondQueryError(c *gin.Context, err error) {
+	if errors.Is(c.Request.Context().Err(), context.Canceled) {
+		log.Printf("Запрос %s отменен клиентом", c.Request.URL.Path)
+		c.AbortWithStatus(statusClientClosedRequest)
+		return
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgQueryCanceled:
+			c.JSON(http.StatusRequestTimeout, gin.H{
+				"error":   "Превышено время выполнения запроса",
+				"timeout": sqlLimits.StatementTimeout.String(),
+			})
+			return
+		case pgReadOnlySQLTransaction:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Запрос пытается изменить данные"})
+			return
+		case pgInsufficientPrivilege:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав в БД: " + pgErr.Message, "code": "forbidden"})
+			return
+		}
+		switch {
+		case strings.HasPrefix(pgErr.Code, pgClassDataException):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное значение: " + pgErr.Message})
+			return
+		case strings.HasPrefix(pgErr.Code, pgClassIntegrityViolation):
+			c.JSON(http.StatusConflict, gin.H{"error": "Нарушено ограничение: " + pgErr.Message, "constraint": pgErr.ConstraintName})
+			return
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusRequestTimeout, gin.H{
+			"error":   "Превышено время выполнения запроса",
+			"timeout": sqlLimits.StatementTimeout.String(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute query: " + err.Error()})
+}
+
+// Идентификатор в двойных кавычках
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
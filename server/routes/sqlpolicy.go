@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"EPS/database"
+	"EPS/sqlguard"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничения пользовательского SQL
+type SQLConfig struct {
+	Tables    []string // доступные таблицы; пусто - все таблицы приложения
+	Functions []string // функции сверх sqlguard.DefaultFunctions
+
+	StatementTimeout time.Duration // statement_timeout запроса на чтение
+	MaxRows          int           // максимум строк в ответе; остальное отбрасывается
+	Role             string        // роль БД для запросов на чтение; пусто - роль подключения
+}
+
+// DefaultSQLConfig возвращает ограничения по умолчанию
+func DefaultSQLConfig() SQLConfig {
+	return SQLConfig{StatementTimeout: 5 * time.Second, MaxRows: 10000}
+}
+
+// ValidateSQLConfig проверяет ограничения пользовательского SQL
+func ValidateSQLConfig(cfg SQLConfig) error {
+	for _, t := range cfg.Tables {
+		if !identifierPattern.MatchString(t) {
+			return fmt.Errorf("недопустимое имя таблицы: %q", t)
+		}
+		if containsString(serviceTables, t) {
+			return fmt.Errorf("служебная таблица %s не может быть доступна для SQL", t)
+		}
+	}
+	for _, f := range cfg.Functions {
+		if !identifierPattern.MatchString(f) {
+			return fmt.Errorf("недопустимое имя функции: %q", f)
+		}
+	}
+	if cfg.StatementTimeout < time.Millisecond || cfg.StatementTimeout > maxQueryStatementTimeout {
+		return fmt.Errorf("statement_timeout должен быть от 1ms до %s", maxQueryStatementTimeout)
+	}
+	if cfg.MaxRows < 1 || cfg.MaxRows > maxQueryRows {
+		return fmt.Errorf("max_rows должен быть от 1 до %d", maxQueryRows)
+	}
+	if cfg.Role != "" && !identifierPattern.MatchString(cfg.Role) {
+		return fmt.Errorf("недопустимое имя роли: %q", cfg.Role)
+	}
+	return nil
+}
+
+// Ограничения выполнения запросов на чтение
+type sqlExecLimits struct {
+	StatementTimeout time.Duration
+	MaxRows          int
+	Role             string
+}
+
+var (
+	sqlTables    []string
+	sqlFunctions = sqlguard.DefaultFunctions
+	sqlLimits    = DefaultSQLConfig().limits()
+)
+
+func (cfg SQLConfig) limits() sqlExecLimits {
+	return sqlExecLimits{
+		StatementTimeout: cfg.StatementTimeout,
+		MaxRows:          cfg.MaxRows,
+		Role:             cfg.Role,
+	}
+}
+
+// ConfigureSQL задает ограничения пользовательского SQL
+func ConfigureSQL(cfg SQLConfig) error {
+	if err := ValidateSQLConfig(cfg); err != nil {
+		return err
+	}
+
+	functions := make(map[string]bool, len(sqlguard.DefaultFunctions)+len(cfg.Functions))
+	for f := range sqlguard.DefaultFunctions {
+		functions[f] = true
+	}
+	for _, f := range cfg.Functions {
+		functions[strings.ToLower(f)] = true
+	}
+
+	sqlTables = cfg.Tables
+	sqlFunctions = functions
+	sqlLimits = cfg.limits()
+	return nil
+}
+
+// Таблицы, доступные для операций с данными: из конфигурации
+// или все таблицы приложения
+func allowedTables() ([]string, error) {
+	if len(sqlTables) > 0 {
+		return sqlTables, nil
+	}
+	return getTables(database.DB)
+}
+
+// Проверяет пользовательский запрос: разрешенный вид оператора, таблицы и функции,
+// затем права пользователя на каждую таблицу. Изменяемая таблица проверяется
+// на writePerm, остальные - на чтение. При отказе отвечает клиенту и возвращает false.
+func checkSQL(c *gin.Context, query string, writePerm Permission, kinds ...sqlguard.Kind) (*sqlguard.Statement, bool) {
+	return checkSQLPolicy(c, query, writePerm, sqlguard.Policy{Kinds: kinds})
+}
+
+// То же, что checkSQL, с дополнительными условиями политики (RequireParams).
+// Таблицы и функции всегда берутся из конфигурации.
+func checkSQLPolicy(c *gin.Context, query string, writePerm Permission, policy sqlguard.Policy) (*sqlguard.Statement, bool) {
+	if strings.TrimSpace(query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SQL query is required"})
+		return nil, false
+	}
+
+	allowed, err := allowedTables()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tables list: " + err.Error()})
+		return nil, false
+	}
+
+	policy.Table = func(name string) bool { return containsString(allowed, name) }
+	policy.Functions = sqlFunctions
+	stmt, err := sqlguard.Validate(query, policy)
+	var guardErr *sqlguard.Error
+	if errors.As(err, &guardErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Query rejected: " + guardErr.Reason,
+			"reason":   guardErr.Reason,
+			"position": guardErr.Pos + 1,
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	for _, table := range stmt.Tables {
+		perm := PermRead
+		if table == stmt.Target {
+			perm = writePerm
+		}
+		if !authorize(c, perm, table) {
+			return nil, false
+		}
+	}
+	return stmt, true
+}
@@ -4,13 +4,33 @@ import (
 	"net/http"
 	"EPS/database"
 	"fmt"
+	"strings"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// Служебные таблицы приложения, которые не показываются в метаданных
+// и недоступны для операций с данными
+var serviceTables = []string{
+	"schema_migrations", "users", "refresh_tokens", "api_keys",
+	"measurement_rollups_1s", "measurement_rollups_1m", "measurement_rollups_15m", "rollup_state",
+	"rollup_dirty_buckets",
+}
+
+func isServiceTable(name string) bool {
+	return containsString(serviceTables, name)
+}
+
+// Таблицы агрегатов служебные, но хранят данные измерений:
+// их можно очищать по сроку и секционировать
+func isRollupTable(name string) bool {
+	return strings.HasPrefix(name, "measurement_rollups_")
+}
+
 type TableInfo struct {
-	TableName string       `json:"table_name"`
-	Columns   []ColumnInfo `json:"columns"`
+	TableName    string           `json:"table_name"`
+	Columns      []ColumnInfo     `json:"columns"`
+	Partitioning *PartitionLayout `json:"partitioning,omitempty"`
 }
 
 type ColumnInfo struct {
@@ -23,9 +43,12 @@ type DatabaseMetadata struct {
 	Tables []TableInfo `json:"tables"`
 }
 
-// GetDatabaseMetadata возвращает метаданные всех таблиц и столбцов
+// GetDatabaseMetadata возвращает метаданные таблиц и столбцов,
+// доступных пользователю для чтения
 func GetDatabaseMetadata(c *gin.Context) {
-	metadata, err := getDatabaseMetadata(database.DB)
+	metadata, err := getDatabaseMetadata(database.DB, func(tables []string) []string {
+		return readableTables(c, tables)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch database metadata: " + err.Error()})
 		return
@@ -42,6 +65,18 @@ func GetTableMetadata(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Table name is required"})
 		return
 	}
+	tables, err := getTables(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tables list: " + err.Error()})
+		return
+	}
+	if !containsString(tables, tableName) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found: " + tableName})
+		return
+	}
+	if !authorize(c, PermRead, tableName) {
+		return
+	}
 
 	columns, err := getTableColumns(database.DB, tableName)
 	if err != nil {
@@ -49,13 +84,20 @@ func GetTableMetadata(c *gin.Context) {
 		return
 	}
 
+	layout, _, err := partitionLayout(database.DB, tableName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch table metadata: " + err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"table_name": tableName,
-		"columns":    columns,
+		"table_name":   tableName,
+		"columns":      columns,
+		"partitioning": layout,
 	})
 }
 
-// GetTablesList возвращает список всех таблиц
+// GetTablesList возвращает список таблиц, доступных пользователю для чтения
 func GetTablesList(c *gin.Context) {
 	tables, err := getTables(database.DB)
 	if err != nil {
@@ -63,16 +105,18 @@ func GetTablesList(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"tables": tables})
+	c.JSON(http.StatusOK, gin.H{"tables": readableTables(c, tables)})
 }
 
 // Вспомогательные функции
 
-func getDatabaseMetadata(db *gorm.DB) (*DatabaseMetadata, error) {
+// filter отбирает таблицы до чтения их колонок
+func getDatabaseMetadata(db *gorm.DB, filter func([]string) []string) (*DatabaseMetadata, error) {
 	tables, err := getTables(db)
 	if err != nil {
 		return nil, err
 	}
+	tables = filter(tables)
 
 	var tableInfos []TableInfo
 	for _, table := range tables {
@@ -80,10 +124,15 @@ func getDatabaseMetadata(db *gorm.DB) (*DatabaseMetadata, error) {
 		if err != nil {
 			return nil, err
 		}
+		layout, _, err := partitionLayout(db, table)
+		if err != nil {
+			return nil, err
+		}
 
 		tableInfos = append(tableInfos, TableInfo{
-			TableName: table,
-			Columns:   columns,
+			TableName:    table,
+			Columns:      columns,
+			Partitioning: layout,
 		})
 	}
 
@@ -93,14 +142,21 @@ func getDatabaseMetadata(db *gorm.DB) (*DatabaseMetadata, error) {
 func getTables(db *gorm.DB) ([]string, error) {
 	var tables []string
 
-	// Запрос для получения списка таблиц в public схеме
+	// Запрос для получения списка таблиц в public схеме.
+	// Секции показываются в метаданных своей таблицы, а не отдельно.
 	result := db.Raw(`
 		SELECT table_name 
 		FROM information_schema.tables 
 		WHERE table_schema = 'public' 
 		AND table_type = 'BASE TABLE'
+		AND table_name NOT IN ?
+		AND table_name NOT IN (
+			SELECT c.relname FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = 'public' AND c.relispartition
+		)
 		ORDER BY table_name
-	`).Scan(&tables)
+	`, serviceTables).Scan(&tables)
 
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get tables: %w", result.Error)
@@ -129,4 +185,27 @@ func getTableColumns(db *gorm.DB, tableName string) ([]ColumnInfo, error) {
 	}
 
 	return columns, nil
-}
\ No newline at end of file
+}
+// Колонки первичного ключа таблицы в порядке ключа; пусто, если ключа нет
+func getPrimaryKey(db *gorm.DB, tableName string) ([]string, error) {
+	var columns []string
+
+	result := db.Raw(`
+		SELECT kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_name = tc.constraint_name
+			AND kcu.table_schema = tc.table_schema
+			AND kcu.table_name = tc.table_name
+		WHERE tc.table_schema = 'public'
+		AND tc.table_name = ?
+		AND tc.constraint_type = 'PRIMARY KEY'
+		ORDER BY kcu.ordinal_position
+	`, tableName).Scan(&columns)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get primary key for table: %w", result.Error)
+	}
+
+	return columns, nil
+}
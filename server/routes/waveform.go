@@ -0,0 +1,226 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Описание генерируемых сигналов сессии
+type WaveformSpec struct {
+	Frequency  float64    `json:"frequency"`  // основная частота, Гц (обычно 50 или 60)
+	ThreePhase bool       `json:"threePhase"` // генерировать фазы A/B/C
+	PhaseShift float64    `json:"phaseShift"` // сдвиг между фазами, градусы (по умолчанию 120)
+	Seed       int64      `json:"seed"`       // зерно шума; 0 - выбрать случайно
+	Current    SignalSpec `json:"current"`
+	Voltage    SignalSpec `json:"voltage"`
+}
+
+// Параметры одного сигнала
+type SignalSpec struct {
+	Amplitude float64        `json:"amplitude"`           // амплитуда основной гармоники
+	Frequency float64        `json:"frequency,omitempty"` // своя частота вместо основной, Гц
+	Phase     float64        `json:"phase"`               // начальная фаза, градусы
+	Offset    float64        `json:"offset"`              // постоянная составляющая
+	Noise     float64        `json:"noise"`               // СКО гауссова шума
+	Harmonics []HarmonicSpec `json:"harmonics,omitempty"`
+}
+
+// Высшая гармоника сигнала
+type HarmonicSpec struct {
+	Order     int     `json:"order"`     // номер гармоники (2, 3, 5, ...)
+	Magnitude float64 `json:"magnitude"` // амплитуда в долях от основной
+	Phase     float64 `json:"phase"`     // фаза, градусы
+}
+
+// Ограничения параметров генератора
+const (
+	maxWaveformFrequency = 1000.0
+	maxHarmonicOrder     = 63
+	maxHarmonics         = 32
+)
+
+// Сигналы по умолчанию - прежние синусоиды тока и напряжения
+func defaultWaveformSpec() WaveformSpec {
+	return WaveformSpec{
+		Current: SignalSpec{Amplitude: 2, Frequency: 0.5, Offset: 2},
+		Voltage: SignalSpec{Amplitude: 4, Frequency: 0.3, Offset: 6},
+	}
+}
+
+// Фазы трехфазной системы
+var phaseNames = []string{"a", "b", "c"}
+
+// Заполняет значения по умолчанию и проверяет описание
+func (spec *WaveformSpec) normalize() error {
+	if spec.Frequency < 0 || spec.Frequency > maxWaveformFrequency {
+		return fmt.Errorf("frequency должна быть в диапазоне 0..%g Гц", maxWaveformFrequency)
+	}
+	if spec.ThreePhase && spec.PhaseShift == 0 {
+		spec.PhaseShift = 120
+	}
+	if spec.Seed == 0 {
+		spec.Seed = time.Now().UnixNano()
+	}
+
+	for name, signal := range map[string]*SignalSpec{"current": &spec.Current, "voltage": &spec.Voltage} {
+		if err := signal.validate(spec.Frequency); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Наибольшая частота среди сигналов и гармоник, Гц.
+// drift - наибольшее отклонение частоты от событий сценария,
+// гармоники смещаются на drift, умноженный на номер.
+func (spec *WaveformSpec) maxFrequency(drift float64) float64 {
+	var result float64
+	for _, s := range []SignalSpec{spec.Current, spec.Voltage} {
+		freq := s.Frequency
+		if freq == 0 {
+			freq = spec.Frequency
+		}
+		freq += drift
+		result = math.Max(result, freq)
+		for _, h := range s.Harmonics {
+			result = math.Max(result, freq*float64(h.Order))
+		}
+	}
+	return result
+}
+
+func (s *SignalSpec) validate(fundamental float64) error {
+	if s.Amplitude < 0 || s.Noise < 0 {
+		return fmt.Errorf("amplitude и noise не могут быть отрицательными")
+	}
+	if s.Frequency < 0 || s.Frequency > maxWaveformFrequency {
+		return fmt.Errorf("frequency должна быть в диапазоне 0..%g Гц", maxWaveformFrequency)
+	}
+	if s.Frequency == 0 && fundamental == 0 && s.Amplitude > 0 {
+		return fmt.Errorf("не задана частота сигнала")
+	}
+	if len(s.Harmonics) > maxHarmonics {
+		return fmt.Errorf("не более %d гармоник", maxHarmonics)
+	}
+	for _, h := range s.Harmonics {
+		if h.Order < 2 || h.Order > maxHarmonicOrder {
+			return fmt.Errorf("номер гармоники должен быть в диапазоне 2..%d", maxHarmonicOrder)
+		}
+		if h.Magnitude < 0 {
+			return fmt.Errorf("амплитуда гармоники не может быть отрицательной")
+		}
+	}
+	return nil
+}
+
+// Один канал генератора
+type waveformChannel struct {
+	signalType string
+	kind       string // "current" или "voltage"
+	phaseName  string // "a", "b", "c" или пусто для однофазного режима
+	signal     SignalSpec
+	frequency  float64
+	phase      float64 // радианы, с учетом сдвига фазы
+}
+
+// Значение сигнала в момент времени
+type signalValue struct {
+	Type     string
+	Value    float64
+	Overload bool
+}
+
+// Генератор сигналов по описанию WaveformSpec
+type waveformGenerator struct {
+	channels []waveformChannel
+	events   []ScenarioEvent
+	rng      *rand.Rand
+}
+
+func newWaveformGenerator(spec WaveformSpec, events []ScenarioEvent) *waveformGenerator {
+	g := &waveformGenerator{
+		events: events,
+		rng:    rand.New(rand.NewSource(spec.Seed)),
+	}
+
+	for _, kind := range []string{"current", "voltage"} {
+		signal := spec.Current
+		if kind == "voltage" {
+			signal = spec.Voltage
+		}
+		freq := signal.Frequency
+		if freq == 0 {
+			freq = spec.Frequency
+		}
+		base := signal.Phase * math.Pi / 180
+
+		if !spec.ThreePhase {
+			g.channels = append(g.channels, waveformChannel{kind, kind, "", signal, freq, base})
+			continue
+		}
+		for i, name := range phaseNames {
+			shift := float64(i) * spec.PhaseShift * math.Pi / 180
+			g.channels = append(g.channels, waveformChannel{kind + "_" + name, kind, name, signal, freq, base - shift})
+		}
+	}
+	return g
+}
+
+// Значения всех каналов в момент t (секунды от начала генерации)
+func (g *waveformGenerator) sample(t float64) []signalValue {
+	values := make([]signalValue, len(g.channels))
+	for i, ch := range g.channels {
+		values[i] = g.channelValue(ch, t)
+	}
+	return values
+}
+
+func (g *waveformGenerator) channelValue(ch waveformChannel, t float64) signalValue {
+	s := ch.signal
+
+	// Набег фазы с учетом дрейфа частоты из сценария
+	angle := 2*math.Pi*ch.frequency*t + ch.phase + g.driftPhase(t)
+
+	ac := s.Amplitude * math.Sin(angle)
+	for _, h := range s.Harmonics {
+		order := float64(h.Order)
+		// Фаза гармоники смещается вместе с фазой основной (n * сдвиг фазы)
+		ac += s.Amplitude * h.Magnitude * math.Sin(order*angle+h.Phase*math.Pi/180)
+	}
+
+	ac, overload := g.applyEvents(ch, t, ac)
+
+	v := ac + s.Offset
+	if s.Noise > 0 {
+		v += g.rng.NormFloat64() * s.Noise
+	}
+
+	// Округляем до 3 знаков
+	return signalValue{
+		Type:     ch.signalType,
+		Value:    math.Round(v*1000) / 1000,
+		Overload: overload,
+	}
+}
+
+// Значения тока и напряжения для записи в БД (фаза A для трехфазного режима)
+// и признак перегрузки по любому каналу
+func primaryValues(values []signalValue) (current, voltage float64, overload bool) {
+	foundCurrent, foundVoltage := false, false
+	for _, v := range values {
+		overload = overload || v.Overload
+		switch v.Type {
+		case "current", "current_a":
+			if !foundCurrent {
+				current, foundCurrent = v.Value, true
+			}
+		case "voltage", "voltage_a":
+			if !foundVoltage {
+				voltage, foundVoltage = v.Value, true
+			}
+		}
+	}
+	return current, voltage, overload
+}
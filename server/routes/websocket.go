@@ -0,0 +1,302 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	broadcast = make(chan ChartData)
+	upgrader  = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+		// Формат кадров данных; без подпротокола используется JSON
+		Subprotocols: []string{subprotocolJSON, subprotocolProtobuf},
+	}
+)
+
+// Максимальный размер управляющего сообщения от клиента
+const wsMaxMessageSize = 4096
+
+// Подписка на все графики или все типы сигналов
+const wsAnyChart = "*"
+const wsAnyType = "*"
+
+// Управляющее сообщение от клиента
+type wsControlMessage struct {
+	Action     string   `json:"action"`       // "subscribe", "unsubscribe" или "ping"
+	ID         string   `json:"id,omitempty"` // ID запроса, возвращается в ответе
+	ChartID    string   `json:"chartId"`      // ID графика или "*" для всех графиков
+	Types      []string `json:"types"`        // типы сигналов ("current", "voltage_a", ...), пустой список - все типы
+	WindowMs   int      `json:"windowMs"`     // окно пакетирования в мс, 0 - без пакетов
+	MaxSamples int      `json:"maxSamples"`   // отправить пакет досрочно при N отсчетах
+}
+
+// Ответ сервера на управляющее сообщение
+type wsControlReply struct {
+	Type       string   `json:"type"` // "ack" или "error"
+	ID         string   `json:"id,omitempty"`
+	Action     string   `json:"action,omitempty"`
+	ChartID    string   `json:"chartId,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	WindowMs   int      `json:"windowMs,omitempty"`
+	MaxSamples int      `json:"maxSamples,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Подписка клиента на один график
+type wsSubscription struct {
+	allTypes   bool
+	types      map[string]bool
+	window     time.Duration
+	maxSamples int
+}
+
+// Отправляются ли данные подписки пакетами
+func (s *wsSubscription) batched() bool {
+	return s.window > 0 || s.maxSamples > 0
+}
+
+// Подключенный клиент, его очередь отправки и подписки
+type wsClient struct {
+	conn *websocket.Conn
+	hub  *wsHub
+	cfg  StreamConfig
+
+	queueMu sync.Mutex
+	queue   []interface{}
+	closed  bool
+	notify  chan struct{} // сигнал горутине записи
+	done    chan struct{}
+
+	mu   sync.RWMutex
+	subs map[string]*wsSubscription // chartId -> подписка
+
+	batchMu sync.Mutex
+	batches map[string]*pendingBatch // chartId -> накапливаемый пакет
+}
+
+func newWSClient(conn *websocket.Conn, h *wsHub) *wsClient {
+	return &wsClient{
+		conn:    conn,
+		hub:     h,
+		cfg:     h.config(),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		subs:    make(map[string]*wsSubscription),
+		batches: make(map[string]*pendingBatch),
+	}
+}
+
+// WebSocketHandler для подключения клиентов
+func WebSocketHandler(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	client := newWSClient(conn, hub)
+	log.Printf("WebSocket client connected. Total clients: %d", hub.register(client))
+	defer func() {
+		client.close()
+		log.Printf("WebSocket client disconnected. Total clients: %d", hub.unregister(client))
+	}()
+
+	go client.writePump()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(client.cfg.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(client.cfg.PongTimeout))
+	})
+
+	// Обработка управляющих сообщений от клиента
+	for {
+		messageType, p, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		// Любое сообщение от клиента подтверждает, что соединение живо
+		conn.SetReadDeadline(time.Now().Add(client.cfg.PongTimeout))
+
+		if messageType != websocket.TextMessage {
+			client.enqueue(wsControlReply{Type: "error", Error: "Ожидается текстовое JSON сообщение"})
+			continue
+		}
+
+		var msg wsControlMessage
+		if err := json.Unmarshal(p, &msg); err != nil {
+			client.enqueue(wsControlReply{Type: "error", Error: "Неверный формат сообщения: " + err.Error()})
+			continue
+		}
+
+		client.enqueue(client.handleControl(msg))
+	}
+}
+
+// Обработка одного управляющего сообщения
+func (cl *wsClient) handleControl(msg wsControlMessage) wsControlReply {
+	reply := wsControlReply{
+		Type:    "ack",
+		ID:      msg.ID,
+		Action:  msg.Action,
+		ChartID: msg.ChartID,
+	}
+
+	fail := func(text string) wsControlReply {
+		reply.Type = "error"
+		reply.Error = text
+		return reply
+	}
+
+	switch msg.Action {
+	case "ping":
+		return reply
+	case "subscribe", "unsubscribe":
+	case "":
+		return fail("Не указано поле action")
+	default:
+		return fail("Неизвестное действие: " + msg.Action)
+	}
+
+	if msg.ChartID == "" {
+		return fail("Не указан chartId")
+	}
+	for _, t := range msg.Types {
+		if !identifierPattern.MatchString(t) {
+			return fail("Недопустимый тип сигнала: " + t)
+		}
+	}
+
+	if msg.Action == "subscribe" {
+		if msg.WindowMs < 0 || msg.WindowMs > maxBatchWindowMs {
+			return fail(fmt.Sprintf("windowMs должен быть в диапазоне 0..%d", maxBatchWindowMs))
+		}
+		if msg.MaxSamples < 0 || msg.MaxSamples > maxBatchSamples {
+			return fail(fmt.Sprintf("maxSamples должен быть в диапазоне 0..%d", maxBatchSamples))
+		}
+
+		sub := cl.subscribe(msg.ChartID, msg.Types, msg.WindowMs, msg.MaxSamples)
+		reply.Types = sub.typeList()
+		reply.WindowMs = int(sub.window / time.Millisecond)
+		reply.MaxSamples = sub.maxSamples
+		return reply
+	}
+
+	if err := cl.unsubscribe(msg.ChartID, msg.Types); err != nil {
+		return fail(err.Error())
+	}
+	reply.Types = msg.Types
+	return reply
+}
+
+// Добавляет подписку и возвращает ее итоговое состояние.
+// Параметры пакетирования заменяют ранее заданные для графика.
+func (cl *wsClient) subscribe(chartID string, types []string, windowMs, maxSamples int) wsSubscription {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	sub := cl.subs[chartID]
+	if sub == nil {
+		sub = &wsSubscription{types: make(map[string]bool)}
+		cl.subs[chartID] = sub
+	}
+
+	if len(types) == 0 {
+		sub.allTypes = true
+		sub.types = make(map[string]bool)
+	}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	sub.window = time.Duration(windowMs) * time.Millisecond
+	sub.maxSamples = maxSamples
+	// Пакет по количеству все равно нужно когда-то отправить
+	if sub.maxSamples > 0 && sub.window == 0 {
+		sub.window = defaultBatchWindow
+	}
+
+	return wsSubscription{
+		allTypes:   sub.allTypes,
+		types:      copyTypeSet(sub.types),
+		window:     sub.window,
+		maxSamples: sub.maxSamples,
+	}
+}
+
+func (s wsSubscription) typeList() []string {
+	if s.allTypes {
+		return []string{wsAnyType}
+	}
+	result := make([]string, 0, len(s.types))
+	for t := range s.types {
+		result = append(result, t)
+	}
+	return result
+}
+
+func copyTypeSet(set map[string]bool) map[string]bool {
+	result := make(map[string]bool, len(set))
+	for t := range set {
+		result[t] = true
+	}
+	return result
+}
+
+// Удаляет подписку; без типов удаляется весь график
+func (cl *wsClient) unsubscribe(chartID string, types []string) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	sub, ok := cl.subs[chartID]
+	if !ok {
+		return fmt.Errorf("нет подписки на график %s", chartID)
+	}
+	if sub.allTypes && len(types) > 0 {
+		return fmt.Errorf("подписка на все типы сигналов снимается только целиком")
+	}
+
+	for _, t := range types {
+		delete(sub.types, t)
+	}
+	if len(types) == 0 || len(sub.types) == 0 {
+		delete(cl.subs, chartID)
+	}
+	return nil
+}
+
+// Возвращает параметры подписки, под которую попадают данные.
+// Подписка на конкретный график приоритетнее подписки на все графики.
+func (cl *wsClient) match(data ChartData) (window time.Duration, maxSamples int, ok bool) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	for _, chartID := range []string{data.ChartID, wsAnyChart} {
+		if sub, found := cl.subs[chartID]; found && (sub.allTypes || sub.types[data.Type]) {
+			return sub.window, sub.maxSamples, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Рассылка данных подписанным клиентам
+func broadcastData() {
+	for data := range broadcast {
+		hub.publish(data)
+	}
+}
+
+// Запускаем broadcast горутину
+func init() {
+	go broadcastData()
+}
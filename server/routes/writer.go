@@ -0,0 +1,433 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"EPS/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// Настройки асинхронной записи измерений
+type WriterConfig struct {
+	BatchSize     int           // сбросить буфер при таком числе строк
+	FlushInterval time.Duration // сбросить буфер не реже этого интервала
+	QueueSize     int           // максимум строк в очереди на запись
+	MaxRetries    int           // повторы неудачной записи пачки
+	RetryBackoff  time.Duration // начальная пауза между повторами, удваивается
+}
+
+// Настройки по умолчанию
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		BatchSize:     5000,
+		FlushInterval: 500 * time.Millisecond,
+		QueueSize:     200000,
+		MaxRetries:    5,
+		RetryBackoff:  200 * time.Millisecond,
+	}
+}
+
+func (cfg WriterConfig) validate() error {
+	if cfg.BatchSize <= 0 || cfg.QueueSize <= 0 {
+		return fmt.Errorf("размер пачки и очереди должны быть положительными")
+	}
+	if cfg.QueueSize < cfg.BatchSize {
+		return fmt.Errorf("очередь не может быть меньше пачки")
+	}
+	if cfg.FlushInterval <= 0 || cfg.RetryBackoff <= 0 {
+		return fmt.Errorf("интервалы должны быть положительными")
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("число повторов не может быть отрицательным")
+	}
+	return nil
+}
+
+// Метрики записи для статуса генерации
+type WriterStats struct {
+	Queued        int       `json:"queued"`        // строк ожидает записи
+	Retrying      int64     `json:"retrying"`      // строк в пачках, ожидающих повтора
+	Written       uint64    `json:"written"`       // записано строк всего
+	Dropped       uint64    `json:"dropped"`       // потеряно строк (очередь полна или исчерпаны повторы)
+	QueueFull     uint64    `json:"queueFull"`     // из них не принято в полную очередь
+	Flushes       uint64    `json:"flushes"`       // успешных сбросов
+	FlushErrors   uint64    `json:"flushErrors"`   // неудачных попыток записи
+	RowsPerSecond float64   `json:"rowsPerSecond"` // скорость записи за последний сброс
+	LagMs         int64     `json:"lagMs"`         // возраст самой старой строки в последнем сбросе
+	LastFlush     time.Time `json:"lastFlush"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// Строка в очереди на запись
+type queuedMeasurement struct {
+	table string
+	m     CurrentMeasurement
+}
+
+// Пачка, запись которой не удалась и будет повторена
+type retryBatch struct {
+	table   string
+	rows    []CurrentMeasurement
+	attempt int       // сделано попыток
+	next    time.Time // время следующей попытки
+}
+
+// Асинхронная запись измерений пачками через COPY
+type measurementWriter struct {
+	cfg   WriterConfig
+	queue chan queuedMeasurement
+	once  sync.Once
+
+	started  atomic.Bool
+	stopping atomic.Bool
+	stop     chan struct{} // закрывается при остановке сервера
+	done     chan struct{} // закрывается после дозаписи очереди
+
+	// Тип колонки measurement_time по таблицам - определяет, передавать время строкой или time.Time
+	timeColumnMu     sync.Mutex
+	timeColumnIsText map[string]bool
+
+	written     atomic.Uint64
+	dropped     atomic.Uint64
+	queueFull   atomic.Uint64
+	retrying    atomic.Int64
+	flushes     atomic.Uint64
+	flushErrors atomic.Uint64
+
+	statsMu       sync.Mutex
+	rowsPerSecond float64
+	lag           time.Duration
+	lastFlush     time.Time
+	lastError     string
+}
+
+var writer = newMeasurementWriter(DefaultWriterConfig())
+
+func newMeasurementWriter(cfg WriterConfig) *measurementWriter {
+	return &measurementWriter{
+		cfg:              cfg,
+		queue:            make(chan queuedMeasurement, cfg.QueueSize),
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+		timeColumnIsText: make(map[string]bool),
+	}
+}
+
+// ValidateWriterConfig проверяет настройки записи измерений
+func ValidateWriterConfig(cfg WriterConfig) error {
+	return cfg.validate()
+}
+
+// ConfigureWriter задает настройки записи измерений.
+// Вызывается при старте сервера, до запуска генерации.
+func ConfigureWriter(cfg WriterConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	writer = newMeasurementWriter(cfg)
+	return nil
+}
+
+// Ставит измерения в очередь на запись. Не блокируется: когда очередь
+// (вместе с пачками, ожидающими повтора) заполнена или сервер
+// останавливается, оставшиеся строки не принимаются. Возвращает число
+// непринятых строк - это всегда хвост data, его можно отправить повторно.
+func (w *measurementWriter) enqueue(table string, data []CurrentMeasurement) int {
+	if w.stopping.Load() {
+		w.rejected(len(data))
+		return len(data)
+	}
+	w.once.Do(func() {
+		w.started.Store(true)
+		go w.run(database.DB)
+	})
+
+	for i, m := range data {
+		full := len(w.queue)+int(w.retrying.Load()) >= w.cfg.QueueSize
+		if !full {
+			select {
+			case w.queue <- queuedMeasurement{table: table, m: m}:
+				continue
+			default:
+			}
+		}
+		w.rejected(len(data) - i)
+		return len(data) - i
+	}
+	return 0
+}
+
+func (w *measurementWriter) rejected(n int) {
+	w.dropped.Add(uint64(n))
+	w.queueFull.Add(uint64(n))
+}
+
+// Через сколько секунд клиенту стоит повторить непринятые строки
+func (w *measurementWriter) retryAfterSeconds() int {
+	return int((w.cfg.FlushInterval + time.Second - 1) / time.Second)
+}
+
+// Основной цикл: копит строки и сбрасывает по размеру или по времени.
+// Неудачные пачки повторяются по таймеру, не задерживая запись новых строк.
+func (w *measurementWriter) run(db *gorm.DB) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	pending := make([]queuedMeasurement, 0, w.cfg.BatchSize)
+	var retries []retryBatch
+	for {
+		select {
+		case item := <-w.queue:
+			pending = append(pending, item)
+			if len(pending) < w.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			retries = w.retry(db, retries, false)
+			if len(pending) == 0 {
+				continue
+			}
+		case <-w.stop:
+			// Дозаписываем очередь и отложенные пачки: по одной попытке
+			for len(w.queue) > 0 {
+				pending = append(pending, <-w.queue)
+			}
+			if len(pending) > 0 {
+				retries = append(retries, w.flush(db, pending)...)
+			}
+			w.retry(db, retries, true)
+			return
+		}
+
+		retries = append(retries, w.flush(db, pending)...)
+		pending = pending[:0]
+	}
+}
+
+// Останавливает запись: новые строки не принимаются, очередь дозаписывается.
+// Возвращает ошибку, если дозапись не уложилась в ctx.
+func (w *measurementWriter) shutdown(ctx context.Context) error {
+	if !w.stopping.CompareAndSwap(false, true) || !w.started.Load() {
+		return nil
+	}
+	close(w.stop)
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("очередь записи не дозаписана, осталось строк: %d", len(w.queue)+int(w.retrying.Load()))
+	}
+}
+
+// ShutdownWriter дозаписывает очередь измерений при остановке сервера
+func ShutdownWriter(ctx context.Context) error {
+	return writer.shutdown(ctx)
+}
+
+// Записывает пачку, группируя строки по таблицам.
+// Возвращает пачки, запись которых нужно повторить.
+func (w *measurementWriter) flush(db *gorm.DB, pending []queuedMeasurement) []retryBatch {
+	started := time.Now()
+	oldest := pending[0].m.MeasurementTime
+
+	byTable := make(map[string][]CurrentMeasurement)
+	for _, item := range pending {
+		byTable[item.table] = append(byTable[item.table], item.m)
+		if item.m.MeasurementTime.Before(oldest) {
+			oldest = item.m.MeasurementTime
+		}
+	}
+
+	written := 0
+	var failed []retryBatch
+	for table, rows := range byTable {
+		if err := w.write(db, table, rows); err != nil {
+			batch := retryBatch{table: table, rows: rows, attempt: 1}
+			if w.reschedule(&batch, err) {
+				failed = append(failed, batch)
+			}
+			continue
+		}
+		written += len(rows)
+	}
+
+	w.written.Add(uint64(written))
+	w.flushes.Add(1)
+
+	elapsed := time.Since(started)
+	w.statsMu.Lock()
+	if elapsed > 0 {
+		w.rowsPerSecond = float64(written) / elapsed.Seconds()
+	}
+	w.lag = time.Since(oldest)
+	w.lastFlush = time.Now()
+	w.statsMu.Unlock()
+	return failed
+}
+
+// Одна попытка записи; ошибка учитывается в метриках
+func (w *measurementWriter) write(db *gorm.DB, table string, rows []CurrentMeasurement) error {
+	err := w.copyRows(db, table, rows)
+	if err != nil {
+		w.flushErrors.Add(1)
+		w.statsMu.Lock()
+		w.lastError = err.Error()
+		w.statsMu.Unlock()
+	}
+	return err
+}
+
+// Назначает следующую попытку после неудачной с паузой, удваивающейся
+// с каждой попыткой. Если повторы исчерпаны, пачка теряется и возвращается false.
+func (w *measurementWriter) reschedule(batch *retryBatch, err error) bool {
+	if batch.attempt > w.cfg.MaxRetries {
+		w.dropped.Add(uint64(len(batch.rows)))
+		log.Printf("Измерения для %s потеряны после %d попыток: %v", batch.table, batch.attempt, err)
+		return false
+	}
+	if batch.attempt == 1 {
+		w.retrying.Add(int64(len(batch.rows)))
+	}
+	batch.next = time.Now().Add(w.cfg.RetryBackoff << (batch.attempt - 1))
+	return true
+}
+
+// Повторяет пачки, время которых наступило (при force - все сразу);
+// возвращает оставшиеся
+func (w *measurementWriter) retry(db *gorm.DB, retries []retryBatch, force bool) []retryBatch {
+	now := time.Now()
+	remaining := retries[:0]
+	for _, batch := range retries {
+		if !force && batch.next.After(now) {
+			remaining = append(remaining, batch)
+			continue
+		}
+		err := w.write(db, batch.table, batch.rows)
+		if err == nil {
+			w.retrying.Add(-int64(len(batch.rows)))
+			w.written.Add(uint64(len(batch.rows)))
+			continue
+		}
+		batch.attempt++
+		if force {
+			w.dropped.Add(uint64(len(batch.rows)))
+			w.retrying.Add(-int64(len(batch.rows)))
+			log.Printf("Измерения для %s потеряны при остановке после %d попыток: %v", batch.table, batch.attempt, err)
+			continue
+		}
+		if w.reschedule(&batch, err) {
+			remaining = append(remaining, batch)
+		} else {
+			w.retrying.Add(-int64(len(batch.rows)))
+		}
+	}
+	return remaining
+}
+
+var measurementColumns = []string{
+	"measurement_time", "current_value", "voltage_value", "circuit_id", "sensor_model", "is_overload",
+}
+
+// Запись строк через COPY FROM на соединении pgx из пула GORM.
+// Если драйвер не pgx, используется обычная пакетная вставка
+// на том же соединении.
+func (w *measurementWriter) copyRows(db *gorm.DB, table string, rows []CurrentMeasurement) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	textTime, err := w.timeColumnText(db, table)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fallback := false
+	err = conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			fallback = true
+			return nil
+		}
+
+		source := pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+			r := rows[i]
+			var measurementTime any = r.MeasurementTime
+			if textTime {
+				measurementTime = r.MeasurementTime.UTC().Format(time.RFC3339Nano)
+			}
+			return []any{measurementTime, r.CurrentValue, r.VoltageValue, r.CircuitID, r.SensorModel, r.IsOverload}, nil
+		})
+
+		_, err := stdConn.Conn().CopyFrom(ctx, pgx.Identifier{table}, measurementColumns, source)
+		return err
+	})
+	if err != nil || !fallback {
+		return err
+	}
+
+	// Запросы GORM на удерживаемом соединении, а не на пуле
+	tx := db.WithContext(ctx)
+	tx.Statement.ConnPool = conn
+	return insertData(tx, table, rows)
+}
+
+// Хранится ли measurement_time в таблице как текст
+func (w *measurementWriter) timeColumnText(db *gorm.DB, table string) (bool, error) {
+	w.timeColumnMu.Lock()
+	defer w.timeColumnMu.Unlock()
+
+	if isText, ok := w.timeColumnIsText[table]; ok {
+		return isText, nil
+	}
+
+	columns, err := getTableColumns(db, table)
+	if err != nil {
+		return false, err
+	}
+	for _, col := range columns {
+		if col.ColumnName == "measurement_time" {
+			isText := !strings.HasPrefix(col.DataType, "timestamp")
+			w.timeColumnIsText[table] = isText
+			return isText, nil
+		}
+	}
+	return false, fmt.Errorf("в таблице %s нет колонки measurement_time", table)
+}
+
+func (w *measurementWriter) stats() WriterStats {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	return WriterStats{
+		Queued:        len(w.queue),
+		Retrying:      w.retrying.Load(),
+		Written:       w.written.Load(),
+		Dropped:       w.dropped.Load(),
+		QueueFull:     w.queueFull.Load(),
+		Flushes:       w.flushes.Load(),
+		FlushErrors:   w.flushErrors.Load(),
+		RowsPerSecond: w.rowsPerSecond,
+		LagMs:         w.lag.Milliseconds(),
+		LastFlush:     w.lastFlush,
+		LastError:     w.lastError,
+	}
+}
@@ -0,0 +1,231 @@
+package sqlguard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Запросы в синтаксисе PostgreSQL: разные формы элементов FROM, подзапросы,
+// CTE и изменяющие операторы. Используются как корпус для сверки с планом
+// настоящего сервера и как начальные данные для FuzzValidate.
+var grammarCorpus = []string{
+	"SELECT * FROM current_measurements",
+	"SELECT * FROM ONLY current_measurements",
+	"SELECT * FROM ONLY (current_measurements)",
+	"SELECT * FROM current_measurements *",
+	"SELECT * FROM ONLY (users)",
+	"SELECT 1 FROM circuits, ONLY (refresh_tokens)",
+	"SELECT 1 FROM circuits JOIN ONLY (api_keys) ON true",
+	"SELECT 1 FROM circuits c LEFT JOIN LATERAL (SELECT * FROM users u WHERE u.id = c.id) x ON true",
+	"SELECT * FROM (circuits c JOIN users u ON u.id = c.id)",
+	"SELECT * FROM ((circuits c JOIN users u ON u.id = c.id) JOIN api_keys k ON k.user_id = u.id)",
+	"SELECT * FROM circuits NATURAL JOIN users",
+	"SELECT * FROM circuits CROSS JOIN LATERAL generate_series(1, c.id) AS g(n)",
+	"SELECT * FROM circuits AS c(a, b) JOIN users u ON u.id = c.a",
+	"SELECT * FROM current_measurements TABLESAMPLE SYSTEM (10)",
+	"SELECT * FROM current_measurements m TABLESAMPLE BERNOULLI (5) REPEATABLE (42) WHERE m.id > 0",
+	"SELECT * FROM generate_series(1, 3) WITH ORDINALITY AS g(n, i)",
+	"SELECT * FROM ROWS FROM (generate_series(1, 3), generate_series(1, 2)) AS g(a, b)",
+	"SELECT * FROM (VALUES (1), (2)) AS v(x) JOIN users ON users.id = v.x",
+	"SELECT * FROM (TABLE users) u",
+	"TABLE users",
+	"TABLE ONLY users",
+	"TABLE ONLY (users)",
+	"WITH u AS (SELECT * FROM users) SELECT * FROM u JOIN circuits ON true",
+	"WITH RECURSIVE r(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM r WHERE n < 3) SELECT * FROM r, api_keys",
+	"WITH current_measurements AS (SELECT * FROM users) SELECT * FROM current_measurements",
+	"SELECT (SELECT count(*) FROM refresh_tokens) FROM circuits",
+	"SELECT * FROM circuits WHERE EXISTS (SELECT 1 FROM users WHERE users.id = circuits.id)",
+	"SELECT * FROM circuits WHERE id IN (SELECT user_id FROM api_keys)",
+	"SELECT ARRAY(SELECT id FROM users)",
+	"SELECT * FROM circuits UNION SELECT id, username FROM users",
+	"SELECT extract(epoch FROM measurement_time) FROM current_measurements",
+	"SELECT substring(circuit_id FROM 1 FOR 2) FROM circuits",
+	"SELECT id IS DISTINCT FROM 1 FROM users",
+	"SELECT id IS NOT DISTINCT FROM (SELECT max(id) FROM api_keys) FROM circuits",
+	"SELECT DISTINCT ON (circuit_id) * FROM current_measurements ORDER BY circuit_id, measurement_time DESC",
+	"SELECT count(*) FILTER (WHERE is_overload) FROM current_measurements",
+	"SELECT * FROM current_measurements FETCH FIRST 5 ROWS ONLY",
+	"SELECT * FROM circuits c JOIN users u USING (id)",
+	"SELECT * FROM circuits c JOIN users u ON u.id = c.id, api_keys k",
+	"INSERT INTO circuits (id, circuit_id) SELECT id, username FROM users",
+	"INSERT INTO circuits AS c (id) VALUES (1) ON CONFLICT (id) DO UPDATE SET circuit_id = (SELECT username FROM users LIMIT 1)",
+	"UPDATE ONLY circuits SET circuit_id = u.username FROM users u WHERE u.id = circuits.id",
+	"UPDATE circuits c SET circuit_id = 'x' FROM ONLY (api_keys) k WHERE k.id = c.id RETURNING c.*",
+	"DELETE FROM ONLY circuits USING ONLY (refresh_tokens) r WHERE r.id = circuits.id",
+	"DELETE FROM circuits WHERE id IN (TABLE users LIMIT 1)",
+}
+
+// Таблицы для сверки с планом: те же имена, что в корпусе
+var corpusSchema = []string{
+	"CREATE TABLE current_measurements (id int PRIMARY KEY, circuit_id text, current_value numeric, measurement_time timestamptz, is_overload bool)",
+	"CREATE TABLE circuits (id int PRIMARY KEY, circuit_id text)",
+	"CREATE TABLE users (id int PRIMARY KEY, username text)",
+	"CREATE TABLE refresh_tokens (id int PRIMARY KEY, user_id int)",
+	"CREATE TABLE api_keys (id int PRIMARY KEY, user_id int)",
+}
+
+// Сверка с настоящим PostgreSQL: каждая таблица, которую читает или меняет
+// план запроса, должна быть в Statement.Tables. Запускается, если задан
+// EPS_TEST_DATABASE_URL; схема создается во временной транзакции и откатывается.
+func TestValidatePostgresCorpus(t *testing.T) {
+	url := os.Getenv("EPS_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("EPS_TEST_DATABASE_URL не задан")
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("подключение: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	setup := append([]string{"CREATE SCHEMA sqlguard_corpus", "SET LOCAL search_path = sqlguard_corpus"}, corpusSchema...)
+	for _, sql := range setup {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	permissive := Policy{
+		Kinds:     allKinds,
+		Table:     func(string) bool { return true },
+		Functions: DefaultFunctions,
+	}
+	for _, sql := range grammarCorpus {
+		stmt, err := Validate(sql, permissive)
+		if err != nil {
+			t.Errorf("Validate(%q): %v", sql, err)
+			continue
+		}
+
+		var plan []byte
+		_, err = tx.Exec(ctx, "SAVEPOINT q")
+		if err == nil {
+			err = tx.QueryRow(ctx, "EXPLAIN (VERBOSE, FORMAT JSON) "+sql).Scan(&plan)
+		}
+		if err != nil {
+			t.Errorf("PostgreSQL не разобрал запрос корпуса %q: %v", sql, err)
+			tx.Exec(ctx, "ROLLBACK TO SAVEPOINT q")
+			continue
+		}
+
+		var nodes []map[string]any
+		if err := json.Unmarshal(plan, &nodes); err != nil {
+			t.Fatalf("план %q: %v", sql, err)
+		}
+		seen := make(map[string]bool)
+		for _, n := range nodes {
+			planRelations(n, seen)
+		}
+		for name := range seen {
+			i := sort.SearchStrings(stmt.Tables, name)
+			if i == len(stmt.Tables) || stmt.Tables[i] != name {
+				t.Errorf("%q: план читает %s, а Validate нашел только %v", sql, name, stmt.Tables)
+			}
+		}
+	}
+}
+
+// Собирает "Relation Name" из узлов плана EXPLAIN (FORMAT JSON)
+func planRelations(node map[string]any, seen map[string]bool) {
+	if p, ok := node["Plan"].(map[string]any); ok {
+		planRelations(p, seen)
+	}
+	if name, ok := node["Relation Name"].(string); ok {
+		seen[name] = true
+	}
+	if plans, ok := node["Plans"].([]any); ok {
+		for _, p := range plans {
+			if child, ok := p.(map[string]any); ok {
+				planRelations(child, seen)
+			}
+		}
+	}
+}
+
+// Недоступные в testPolicy таблицы
+var fuzzForbidden = map[string]bool{"users": true, "refresh_tokens": true, "api_keys": true}
+
+// Validate не паникует, отказывает только через *Error и не пропускает
+// запрос, где недоступная таблица стоит на месте элемента FROM/JOIN/TABLE.
+// FROM проверяется только вне скобок: в аргументах функций (extract, substring)
+// после него идет выражение. Запросы с WITH не проверяются по лексемам:
+// имя CTE может совпасть с именем таблицы.
+func FuzzValidate(f *testing.F) {
+	for _, sql := range grammarCorpus {
+		f.Add(sql)
+	}
+	f.Fuzz(func(t *testing.T, sql string) {
+		stmt, err := Validate(sql, testPolicy(allKinds...))
+		if err != nil {
+			var gerr *Error
+			if !errors.As(err, &gerr) {
+				t.Fatalf("ошибка %T, ожидается *Error: %v", err, err)
+			}
+			if gerr.Pos < 0 || gerr.Pos > len(sql) {
+				t.Fatalf("позиция %d вне запроса длины %d", gerr.Pos, len(sql))
+			}
+			return
+		}
+		for _, name := range stmt.Tables {
+			if !testTables[name] {
+				t.Fatalf("%q: пропущена таблица %s", sql, name)
+			}
+		}
+
+		tokens, err := lex(sql)
+		if err != nil {
+			t.Fatalf("%q принят, но не разбирается лексером: %v", sql, err)
+		}
+		for _, tok := range tokens {
+			if tok.is("with") {
+				return
+			}
+		}
+		// Глубина скобок перед каждой лексемой
+		depth := make([]int, len(tokens))
+		for i, tok := range tokens[:len(tokens)-1] {
+			depth[i+1] = depth[i]
+			switch {
+			case tok.punct("("):
+				depth[i+1]++
+			case tok.punct(")"):
+				depth[i+1]--
+			}
+		}
+		for i, tok := range tokens {
+			if !tok.name() || !fuzzForbidden[tok.text] {
+				continue
+			}
+			j := i - 1
+			if j > 0 && tokens[j].punct("(") && tokens[j-1].is("only") {
+				j--
+			}
+			for j >= 0 && tokens[j].is("only", "lateral") {
+				j--
+			}
+			if j < 0 {
+				continue
+			}
+			prev := tokens[j]
+			fromItem := prev.is("join", "table") ||
+				(prev.is("from") && depth[j] == 0 && (j == 0 || !tokens[j-1].is("distinct")))
+			if fromItem {
+				t.Fatalf("%q: таблица %s на месте элемента FROM пропущена", sql, tok.text)
+			}
+		}
+	})
+}
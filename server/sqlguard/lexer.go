@@ -0,0 +1,299 @@
+package sqlguard
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Вид лексемы
+type tokenKind int
+
+const (
+	tokIdent  tokenKind = iota // идентификатор или ключевое слово
+	tokQuoted                  // идентификатор в двойных кавычках
+	tokString                  // строковая константа: '...', E'...', $$...$$
+	tokNumber                  // числовая константа
+	tokParam                   // позиционный параметр $1
+	tokOp                      // оператор: = < >= :: || и т.п.
+	tokPunct                   // ( ) , ; . [ ]
+)
+
+// Лексема SQL
+type token struct {
+	kind tokenKind
+	text string // для tokIdent - в нижнем регистре, для tokQuoted - без кавычек
+	pos  int    // смещение в байтах от начала запроса
+}
+
+func (t token) is(words ...string) bool {
+	if t.kind != tokIdent {
+		return false
+	}
+	for _, w := range words {
+		if t.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (t token) punct(p string) bool {
+	return t.kind == tokPunct && t.text == p
+}
+
+// Имя объекта: идентификатор или идентификатор в кавычках
+func (t token) name() bool {
+	return t.kind == tokIdent || t.kind == tokQuoted
+}
+
+// Символы, из которых PostgreSQL составляет операторы
+const operatorChars = "+-*/<>=~!@#%^&|`?"
+
+// Разбирает запрос на лексемы по правилам PostgreSQL.
+// Комментарии отбрасываются; вложенные /* */ поддерживаются.
+func lex(sql string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			depth := 0
+			for i < len(sql) {
+				if strings.HasPrefix(sql[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(sql[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth != 0 {
+				return nil, &Error{Pos: start, Reason: "незакрытый комментарий"}
+			}
+
+		case c == '\'':
+			end, err := scanString(sql, i, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, sql[i:end], start})
+			i = end
+
+		case (c == 'E' || c == 'e') && i+1 < len(sql) && sql[i+1] == '\'':
+			end, err := scanString(sql, i+1, true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, sql[i:end], start})
+			i = end
+
+		case (c == 'B' || c == 'b' || c == 'X' || c == 'x' || c == 'N' || c == 'n') && i+1 < len(sql) && sql[i+1] == '\'':
+			end, err := scanString(sql, i+1, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, sql[i:end], start})
+			i = end
+
+		case (c == 'U' || c == 'u') && strings.HasPrefix(sql[i+1:], "&'"):
+			end, err := scanString(sql, i+2, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, sql[i:end], start})
+			i = end
+
+		case c == '"', (c == 'U' || c == 'u') && strings.HasPrefix(sql[i+1:], "&\""):
+			q := i
+			if c != '"' {
+				q = i + 2
+			}
+			text, end, err := scanQuotedIdent(sql, q)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokQuoted, text, start})
+			i = end
+
+		case c == '$':
+			if i+1 < len(sql) && isDigit(sql[i+1]) {
+				i++
+				for i < len(sql) && isDigit(sql[i]) {
+					i++
+				}
+				tokens = append(tokens, token{tokParam, sql[start:i], start})
+				break
+			}
+			end, err := scanDollarString(sql, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, sql[i:end], start})
+			i = end
+
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			i = scanNumber(sql, i)
+			tokens = append(tokens, token{tokNumber, sql[start:i], start})
+
+		case isIdentStart(sql, i):
+			for i < len(sql) && isIdentPart(sql, i) {
+				_, size := utf8.DecodeRuneInString(sql[i:])
+				i += size
+			}
+			tokens = append(tokens, token{tokIdent, strings.ToLower(sql[start:i]), start})
+
+		case strings.ContainsRune("(),;[]", rune(c)):
+			tokens = append(tokens, token{tokPunct, string(c), start})
+			i++
+
+		case c == '.':
+			tokens = append(tokens, token{tokPunct, ".", start})
+			i++
+
+		case c == ':':
+			if strings.HasPrefix(sql[i:], "::") {
+				tokens = append(tokens, token{tokOp, "::", start})
+				i += 2
+			} else {
+				tokens = append(tokens, token{tokOp, ":", start})
+				i++
+			}
+
+		case strings.IndexByte(operatorChars, c) >= 0:
+			for i < len(sql) && strings.IndexByte(operatorChars, sql[i]) >= 0 {
+				// Начало комментария завершает оператор
+				if strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*") {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, token{tokOp, sql[start:i], start})
+
+		default:
+			r, _ := utf8.DecodeRuneInString(sql[i:])
+			return nil, &Error{Pos: start, Reason: fmt.Sprintf("недопустимый символ %q", r)}
+		}
+	}
+	return tokens, nil
+}
+
+// Строка в одинарных кавычках; удвоенная кавычка экранирует саму себя,
+// в E-строках экранирует также обратная косая черта
+func scanString(sql string, i int, escapes bool) (int, error) {
+	start := i
+	i++
+	for i < len(sql) {
+		switch {
+		case escapes && sql[i] == '\\':
+			i += 2
+		case sql[i] == '\'':
+			if i+1 < len(sql) && sql[i+1] == '\'' {
+				i += 2
+				continue
+			}
+			return i + 1, nil
+		default:
+			i++
+		}
+	}
+	return 0, &Error{Pos: start, Reason: "незакрытая строковая константа"}
+}
+
+func scanQuotedIdent(sql string, i int) (string, int, error) {
+	start := i
+	var b strings.Builder
+	i++
+	for i < len(sql) {
+		if sql[i] == '"' {
+			if i+1 < len(sql) && sql[i+1] == '"' {
+				b.WriteByte('"')
+				i += 2
+				continue
+			}
+			if b.Len() == 0 {
+				return "", 0, &Error{Pos: start, Reason: "пустой идентификатор в кавычках"}
+			}
+			return b.String(), i + 1, nil
+		}
+		b.WriteByte(sql[i])
+		i++
+	}
+	return "", 0, &Error{Pos: start, Reason: "незакрытый идентификатор в кавычках"}
+}
+
+// Строка в долларовых кавычках: $$...$$ или $tag$...$tag$
+func scanDollarString(sql string, i int) (int, error) {
+	j := i + 1
+	for j < len(sql) && sql[j] != '$' {
+		if !isIdentPart(sql, j) {
+			return 0, &Error{Pos: i, Reason: "недопустимый символ $"}
+		}
+		j++
+	}
+	if j >= len(sql) {
+		return 0, &Error{Pos: i, Reason: "недопустимый символ $"}
+	}
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return 0, &Error{Pos: i, Reason: "незакрытая строка в долларовых кавычках"}
+	}
+	return j + 1 + end + len(tag), nil
+}
+
+func scanNumber(sql string, i int) int {
+	for i < len(sql) && (isDigit(sql[i]) || sql[i] == '_') {
+		i++
+	}
+	if i < len(sql) && sql[i] == '.' && !strings.HasPrefix(sql[i:], "..") {
+		i++
+		for i < len(sql) && (isDigit(sql[i]) || sql[i] == '_') {
+			i++
+		}
+	}
+	if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+		j := i + 1
+		if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+			j++
+		}
+		if j < len(sql) && isDigit(sql[j]) {
+			i = j
+			for i < len(sql) && isDigit(sql[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(sql string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(sql[i:])
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(sql string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(sql[i:])
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
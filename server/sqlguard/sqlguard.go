@@ -0,0 +1,767 @@
+// Package sqlguard проверяет пользовательские SQL-запросы перед выполнением.
+//
+// Запрос разбирается лексером PostgreSQL (строки, идентификаторы в кавычках,
+// долларовые кавычки и комментарии учитываются), после чего по структуре
+// запроса определяются вид оператора, изменяющие CTE, используемые таблицы
+// и функции. Проверка не заменяет права в БД, но отсекает все, что не
+// укладывается в политику, с точной причиной отказа.
+package sqlguard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Вид оператора
+type Kind string
+
+const (
+	Select Kind = "SELECT"
+	Insert Kind = "INSERT"
+	Update Kind = "UPDATE"
+	Delete Kind = "DELETE"
+)
+
+// Ошибка проверки с позицией в запросе
+type Error struct {
+	Pos    int    // смещение в байтах
+	Reason string // причина отказа
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (позиция %d)", e.Reason, e.Pos+1)
+}
+
+// Политика проверки
+type Policy struct {
+	Kinds     []Kind                 // разрешенные виды операторов
+	Table     func(name string) bool // доступна ли таблица (имя в нижнем регистре, без схемы)
+	Functions map[string]bool        // разрешенные функции (имя в нижнем регистре)
+
+	// Значения передаются только параметрами $n: строковые и числовые
+	// константы запрещены, кроме чисел в LIMIT/OFFSET/FETCH и модификаторах типа
+	RequireParams bool
+}
+
+// Результат разбора
+type Statement struct {
+	Kind      Kind
+	Target    string   // изменяемая таблица для INSERT, UPDATE, DELETE
+	Tables    []string // все таблицы запроса, кроме CTE
+	Functions []string // вызванные функции
+	Params    int      // наибольший номер параметра $n
+	Literals  []Literal
+}
+
+// Константа, записанная прямо в запросе
+type Literal struct {
+	Pos  int    // смещение в байтах
+	Text string // текст константы как в запросе
+}
+
+// Функции, безопасные для пользовательских запросов: агрегаты, оконные,
+// математические, строковые и функции даты-времени без побочных эффектов
+var DefaultFunctions = map[string]bool{}
+
+func init() {
+	for _, f := range strings.Fields(`
+		count sum avg min max stddev stddev_pop stddev_samp variance var_pop var_samp
+		percentile_cont percentile_disc mode array_agg string_agg bool_and bool_or every
+		corr covar_pop covar_samp regr_slope regr_intercept
+		row_number rank dense_rank percent_rank cume_dist ntile lag lead first_value last_value nth_value
+		abs ceil ceiling floor round trunc sqrt cbrt power exp ln log log10 sign mod div
+		sin cos tan asin acos atan atan2 pi degrees radians width_bucket greatest least
+		coalesce nullif
+		now date_trunc date_part date_bin extract to_char to_timestamp to_date to_number
+		age make_interval make_timestamp make_timestamptz make_date justify_interval timezone
+		lower upper length char_length octet_length substring substr trim btrim ltrim rtrim
+		concat concat_ws replace split_part left right position strpos lpad rpad initcap reverse format
+		generate_series unnest array_length cardinality
+		jsonb_build_object json_build_object jsonb_agg json_agg
+	`) {
+		DefaultFunctions[f] = true
+	}
+}
+
+// Конструкции вида слово(...), которые не являются вызовом функции
+var nonFunctionWords = wordSet(`
+	in exists any some all array row values over filter as on using and or not where
+	select from join then else when case by having lateral into returning is
+	cast with recursive materialized table only set default check primary key references
+	group order partition window within distinct
+	numeric decimal varchar char character bit time timestamp interval float varying precision
+	conflict sets rollup cube limit offset between like ilike similar zone operator escape
+`)
+
+// Слова, завершающие список FROM
+var fromListEnd = wordSet(`
+	where group having order limit offset fetch union intersect except window for
+	returning set values select into
+`)
+
+// Типы с модификатором в скобках: numeric(10,2), varchar(20)
+var typeModifierWords = wordSet(`
+	numeric decimal varchar char character bit varying time timestamp interval float precision
+`)
+
+// Слова, после которых число - размер выборки, а не значение
+var rowCountWords = wordSet(`limit offset first next`)
+
+// Слова начала соединения
+var joinWords = wordSet(`join inner left right full outer cross natural`)
+
+// Слова после элемента FROM, которые не могут быть его псевдонимом
+var aliasStopWords = wordSet(`
+	where group having order limit offset fetch union intersect except window for
+	returning set values select into on using tablesample with as
+	join inner left right full outer cross natural
+`)
+
+// Встроенные методы TABLESAMPLE
+var sampleMethods = wordSet(`system bernoulli`)
+
+func wordSet(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+// Validate проверяет запрос по политике и возвращает его разбор
+// или *Error с причиной отказа
+func Validate(sql string, p Policy) (*Statement, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ровно один оператор; завершающие ; допустимы
+	for len(tokens) > 0 && tokens[len(tokens)-1].punct(";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return nil, &Error{Pos: 0, Reason: "пустой запрос"}
+	}
+	for _, t := range tokens {
+		if t.punct(";") {
+			return nil, &Error{Pos: t.pos, Reason: "допускается только один оператор"}
+		}
+	}
+
+	a := &analyzer{
+		tokens:      tokens,
+		ctes:        make(map[string][]cteScope),
+		cteHeads:    make(map[int]int),
+		notFunction: make(map[int]bool),
+		tables:      make(map[string]bool),
+		tablePos:    make(map[string]int),
+		functions:   make(map[string]bool),
+		functionPos: make(map[string]int),
+	}
+	if err := a.checkParens(); err != nil {
+		return nil, err
+	}
+
+	stmt, err := a.statement()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.scan(); err != nil {
+		return nil, err
+	}
+
+	if !containsKind(p.Kinds, stmt.Kind) {
+		return nil, &Error{Pos: a.head, Reason: fmt.Sprintf("оператор %s не разрешен, допустимо: %s", stmt.Kind, joinKinds(p.Kinds))}
+	}
+
+	for _, name := range sortedKeys(a.tables) {
+		if p.Table != nil && !p.Table(name) {
+			return nil, &Error{Pos: a.tablePos[name], Reason: fmt.Sprintf("таблица %s недоступна", name)}
+		}
+		stmt.Tables = append(stmt.Tables, name)
+	}
+	for _, name := range sortedKeys(a.functions) {
+		if !p.Functions[name] {
+			return nil, &Error{Pos: a.functionPos[name], Reason: fmt.Sprintf("функция %s не разрешена", name)}
+		}
+		stmt.Functions = append(stmt.Functions, name)
+	}
+	stmt.Params = a.params
+	stmt.Literals = a.literals
+	if p.RequireParams && len(a.literals) > 0 {
+		l := a.literals[0]
+		return nil, &Error{Pos: l.Pos, Reason: fmt.Sprintf("константа %s должна передаваться параметром $n", l.Text)}
+	}
+	return stmt, nil
+}
+
+// Разбор последовательности лексем
+type analyzer struct {
+	tokens []token
+	head   int // позиция главного оператора
+
+	ctes        map[string][]cteScope
+	cteHeads    map[int]int  // начало заголовка CTE "имя (колонки)" -> его последняя лексема
+	notFunction map[int]bool // слова перед скобкой, которые не вызывают функцию: псевдоним t(a, b), TABLESAMPLE
+	tables      map[string]bool
+	tablePos    map[string]int
+	functions   map[string]bool
+	functionPos map[string]int
+	params      int
+	literals    []Literal
+}
+
+func (a *analyzer) at(i int) token {
+	if i < 0 || i >= len(a.tokens) {
+		return token{kind: tokPunct, text: "", pos: a.end()}
+	}
+	return a.tokens[i]
+}
+
+func (a *analyzer) end() int {
+	if len(a.tokens) == 0 {
+		return 0
+	}
+	last := a.tokens[len(a.tokens)-1]
+	return last.pos + len(last.text)
+}
+
+func (a *analyzer) checkParens() error {
+	var open []int
+	for _, t := range a.tokens {
+		switch {
+		case t.punct("("):
+			open = append(open, t.pos)
+		case t.punct(")"):
+			if len(open) == 0 {
+				return &Error{Pos: t.pos, Reason: "лишняя закрывающая скобка"}
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return &Error{Pos: open[len(open)-1], Reason: "незакрытая скобка"}
+	}
+	return nil
+}
+
+// Индекс парной закрывающей скобки
+func (a *analyzer) closing(i int) int {
+	depth := 0
+	for ; i < len(a.tokens); i++ {
+		switch {
+		case a.tokens[i].punct("("):
+			depth++
+		case a.tokens[i].punct(")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(a.tokens)
+}
+
+// Пропускает WITH-список, начиная с лексемы WITH; возвращает индекс после него.
+// Имена CTE запоминаются, тела проверяются на изменяющие операторы.
+func (a *analyzer) withClause(i int) (int, bool, error) {
+	j := i + 1
+	recursive := a.at(j).is("recursive")
+	if recursive {
+		j++
+	}
+	scopeEnd := a.scopeEnd(i)
+	first := true
+	for {
+		name := a.at(j)
+		if !name.name() {
+			return i, false, nil
+		}
+		k := j + 1
+		if a.at(k).punct("(") {
+			k = a.closing(k) + 1
+		}
+		header := k - 1
+		if !a.at(k).is("as") {
+			if first {
+				// Не CTE: WITH TIME ZONE, WITH ORDINALITY и т.п.
+				return i, false, nil
+			}
+			return 0, false, &Error{Pos: a.at(k).pos, Reason: "ожидается AS в определении CTE"}
+		}
+		k++
+		if a.at(k).is("not") {
+			k++
+		}
+		if a.at(k).is("materialized") {
+			k++
+		}
+		if !a.at(k).punct("(") {
+			return 0, false, &Error{Pos: a.at(k).pos, Reason: "ожидается ( после AS в определении CTE"}
+		}
+		body := a.at(k + 1)
+		if body.is("insert", "update", "delete", "merge") {
+			return 0, false, &Error{Pos: body.pos, Reason: fmt.Sprintf("изменяющий CTE (%s) не разрешен", strings.ToUpper(body.text))}
+		}
+		// Имя CTE видно после его определения (в рекурсивном - и в теле)
+		// и до конца запроса, в котором стоит WITH
+		bodyEnd := a.closing(k)
+		scope := cteScope{from: bodyEnd, to: scopeEnd}
+		if recursive {
+			scope.from = j
+		}
+		cte := strings.ToLower(name.text)
+		a.ctes[cte] = append(a.ctes[cte], scope)
+		a.cteHeads[j] = header
+
+		j = bodyEnd + 1
+		first = false
+		if !a.at(j).punct(",") {
+			return j, true, nil
+		}
+		j++
+	}
+}
+
+// Область видимости имени CTE: индексы лексем
+type cteScope struct {
+	from, to int
+}
+
+// Индекс закрывающей скобки, охватывающей лексему i, или конец запроса
+func (a *analyzer) scopeEnd(i int) int {
+	depth := 0
+	for ; i < len(a.tokens); i++ {
+		switch {
+		case a.tokens[i].punct("("):
+			depth++
+		case a.tokens[i].punct(")"):
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return len(a.tokens)
+}
+
+// Ссылается ли имя в позиции i на CTE, а не на таблицу
+func (a *analyzer) isCTE(name string, i int) bool {
+	for _, s := range a.ctes[name] {
+		if i > s.from && i < s.to {
+			return true
+		}
+	}
+	return false
+}
+
+// Определяет вид главного оператора
+func (a *analyzer) statement() (*Statement, error) {
+	i := 0
+	for a.at(i).punct("(") {
+		i++
+	}
+	if a.at(i).is("with") {
+		next, ok, err := a.withClause(i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &Error{Pos: a.at(i).pos, Reason: "неверное предложение WITH"}
+		}
+		i = next
+	}
+
+	t := a.at(i)
+	a.head = t.pos
+	stmt := &Statement{}
+	switch {
+	case t.is("select", "values"):
+		stmt.Kind = Select
+	case t.is("table"):
+		stmt.Kind = Select
+		if _, _, err := a.relation(i+1, false); err != nil {
+			return nil, err
+		}
+	case t.is("insert"):
+		stmt.Kind = Insert
+		if !a.at(i + 1).is("into") {
+			return nil, &Error{Pos: a.at(i + 1).pos, Reason: "ожидается INTO"}
+		}
+		var err error
+		if stmt.Target, _, err = a.relation(i+2, true); err != nil {
+			return nil, err
+		}
+	case t.is("update"):
+		stmt.Kind = Update
+		var err error
+		if stmt.Target, _, err = a.relation(i+1, false); err != nil {
+			return nil, err
+		}
+	case t.is("delete"):
+		stmt.Kind = Delete
+		if !a.at(i + 1).is("from") {
+			return nil, &Error{Pos: a.at(i + 1).pos, Reason: "ожидается FROM"}
+		}
+		var err error
+		if stmt.Target, _, err = a.relation(i+2, false); err != nil {
+			return nil, err
+		}
+	case t.kind == tokIdent:
+		return nil, &Error{Pos: t.pos, Reason: fmt.Sprintf("оператор %s не разрешен", strings.ToUpper(t.text))}
+	default:
+		return nil, &Error{Pos: t.pos, Reason: "ожидается оператор SQL"}
+	}
+
+	if stmt.Target == "" && stmt.Kind != Select {
+		return nil, &Error{Pos: a.at(i + 1).pos, Reason: "не удалось определить изменяемую таблицу"}
+	}
+	return stmt, nil
+}
+
+// Читает имя отношения с позиции i: [ONLY] [схема.]имя или ONLY ([схема.]имя).
+// Возвращает имя таблицы (или "" для подзапроса, функции, CTE) и индекс после имени.
+// Скобка без ONLY - подзапрос или соединение в скобках, ее разбирает scan.
+// Все остальное - отказ: непонятый элемент FROM не должен пропускать таблицу.
+// columns - после имени может идти список колонок (INSERT INTO t (a, b)).
+func (a *analyzer) relation(i int, columns bool) (string, int, error) {
+	only := false
+	for a.at(i).is("only", "lateral") {
+		only = only || a.at(i).is("only")
+		i++
+	}
+
+	if a.at(i).punct("(") {
+		if !only {
+			return "", i, nil
+		}
+		// ONLY (имя)
+		if !a.at(i + 1).name() {
+			return "", i, &Error{Pos: a.at(i + 1).pos, Reason: "ожидается имя таблицы после ONLY ("}
+		}
+		parts, j := a.qualifiedName(i + 1)
+		if !a.at(j).punct(")") {
+			return "", i, &Error{Pos: a.at(j).pos, Reason: "ожидается ) после имени таблицы"}
+		}
+		return a.relationName(parts, i+1), j + 1, nil
+	}
+
+	t := a.at(i)
+	if !t.name() {
+		return "", i, &Error{Pos: t.pos, Reason: "не удалось разобрать элемент FROM"}
+	}
+
+	parts, j := a.qualifiedName(i)
+
+	// Функция в FROM, например generate_series(...)
+	if a.at(j).punct("(") && !columns {
+		if only {
+			return "", i, &Error{Pos: t.pos, Reason: "ONLY допустимо только для таблицы"}
+		}
+		a.function(parts)
+		return "", j, nil
+	}
+	return a.relationName(parts, i), j, nil
+}
+
+// Учитывает таблицу по полному имени; имя CTE таблицей не считается
+func (a *analyzer) relationName(parts []token, i int) string {
+	name := strings.ToLower(parts[len(parts)-1].text)
+	if len(parts) > 1 {
+		schema := strings.ToLower(parts[len(parts)-2].text)
+		if schema != "public" {
+			name = schema + "." + name
+		}
+	}
+	if len(parts) == 1 && a.isCTE(name, i) {
+		return ""
+	}
+	a.table(name, parts[0].pos)
+	return name
+}
+
+// Читает элемент списка FROM с позиции i. Кроме отношения размечает
+// псевдоним со списком колонок и TABLESAMPLE, чтобы их скобки не приняли
+// за вызов функции. Возвращает индекс, с которого scan продолжает обход:
+// аргументы функции, подзапрос и выражения TABLESAMPLE проверяются им.
+func (a *analyzer) fromItem(i int) (int, error) {
+	_, next, err := a.relation(i, false)
+	if err != nil {
+		return i, err
+	}
+
+	k := next
+	if a.at(k).punct("(") {
+		k = a.closing(k) + 1
+	}
+	if a.at(k).is("with") && a.at(k+1).is("ordinality") {
+		k += 2
+	}
+	if a.at(k).is("as") {
+		k++
+		if !a.at(k).name() {
+			return i, &Error{Pos: a.at(k).pos, Reason: "ожидается псевдоним после AS"}
+		}
+	}
+	if alias := a.at(k); alias.kind == tokQuoted || (alias.kind == tokIdent && !aliasStopWords[alias.text]) {
+		a.notFunction[k] = true
+		k++
+	}
+
+	if a.at(k).is("tablesample") {
+		method := a.at(k + 1)
+		if !method.name() || !a.at(k+2).punct("(") {
+			return i, &Error{Pos: method.pos, Reason: "ожидается метод TABLESAMPLE и его аргументы"}
+		}
+		if method.kind != tokIdent || !sampleMethods[method.text] {
+			return i, &Error{Pos: method.pos, Reason: fmt.Sprintf("метод выборки %s не разрешен", method.text)}
+		}
+		a.notFunction[k+1] = true
+		if end := a.closing(k + 2); a.at(end + 1).is("repeatable") {
+			a.notFunction[end+1] = true
+		}
+	}
+	return next, nil
+}
+
+// Читает имя вида a.b.c с позиции i; возвращает части и индекс после имени
+func (a *analyzer) qualifiedName(i int) ([]token, int) {
+	parts := []token{a.at(i)}
+	j := i + 1
+	for a.at(j).punct(".") && a.at(j+1).name() {
+		parts = append(parts, a.at(j+1))
+		j += 2
+	}
+	return parts, j
+}
+
+func (a *analyzer) table(name string, pos int) {
+	if !a.tables[name] {
+		a.tables[name] = true
+		a.tablePos[name] = pos
+	}
+}
+
+func (a *analyzer) literal(t token) {
+	a.literals = append(a.literals, Literal{Pos: t.pos, Text: t.text})
+}
+
+func (a *analyzer) function(parts []token) {
+	name := strings.ToLower(parts[len(parts)-1].text)
+	if len(parts) > 1 {
+		schema := strings.ToLower(parts[len(parts)-2].text)
+		if schema != "pg_catalog" {
+			name = schema + "." + name
+		}
+	}
+	if !a.functions[name] {
+		a.functions[name] = true
+		a.functionPos[name] = parts[0].pos
+	}
+}
+
+// Вид скобок для разбора FROM внутри них
+type parenFrame struct {
+	args   bool // аргументы функции: FROM внутри - часть синтаксиса (EXTRACT, SUBSTRING)
+	inFrom bool // идет список FROM
+	typmod bool // модификатор типа: numeric(10,2)
+}
+
+// Проходит по всем лексемам: находит таблицы в FROM/JOIN/USING,
+// вызовы функций, изменяющие подзапросы, SELECT INTO и блокировки строк
+func (a *analyzer) scan() error {
+	stack := []parenFrame{{}}
+	for i := 0; i < len(a.tokens); i++ {
+		t := a.tokens[i]
+		top := &stack[len(stack)-1]
+		prev := a.at(i - 1)
+		next := a.at(i + 1)
+
+		// Заголовок CTE "имя (колонки)" - не вызов функции
+		if end, ok := a.cteHeads[i]; ok {
+			i = end
+			continue
+		}
+
+		switch {
+		case t.punct("("):
+			frame := parenFrame{}
+			subquery := next.is("select", "with", "values", "table")
+			switch {
+			case top.inFrom && !subquery && (prev.is("from", "join", "lateral") || prev.punct(",") || prev.punct("(")):
+				// Скобки в списке FROM: (a JOIN b ON ...)
+				frame.inFrom = true
+				stack = append(stack, frame)
+				end, err := a.fromItem(i + 1)
+				if err != nil {
+					return err
+				}
+				i = end - 1
+				continue
+			case prev.name() && (isTypeName(a, i-1) || (prev.kind == tokIdent && typeModifierWords[prev.text])):
+				frame.typmod = true
+			case !subquery && prev.name() && !isKeywordBeforeParen(prev):
+				frame.args = true
+			}
+			stack = append(stack, frame)
+			continue
+
+		case t.punct(")"):
+			stack = stack[:len(stack)-1]
+			continue
+
+		case t.kind == tokParam:
+			var n int
+			fmt.Sscanf(t.text[1:], "%d", &n)
+			if n > a.params {
+				a.params = n
+			}
+			continue
+
+		case t.kind == tokString:
+			a.literal(t)
+			continue
+
+		case t.kind == tokNumber:
+			if !top.typmod && !(prev.kind == tokIdent && rowCountWords[prev.text]) {
+				a.literal(t)
+			}
+			continue
+
+		case t.punct(",") && top.inFrom:
+			end, err := a.fromItem(i + 1)
+			if err != nil {
+				return err
+			}
+			i = end - 1
+			continue
+
+		case t.kind == tokQuoted && next.punct("("):
+			// Функция с именем в кавычках: "pg_sleep"(1)
+			if !isTypeName(a, i) && !a.notFunction[i] {
+				a.function(a.nameEndingAt(i))
+			}
+			continue
+
+		case t.kind != tokIdent:
+			continue
+		}
+
+		// Изменяющий оператор внутри скобок
+		if t.is("insert", "update", "delete", "merge") && prev.punct("(") {
+			return &Error{Pos: t.pos, Reason: fmt.Sprintf("вложенный %s не разрешен", strings.ToUpper(t.text))}
+		}
+
+		switch {
+		case t.is("with") && next.name() && !next.is("ordinality") && !top.args:
+			if _, _, err := a.withClause(i); err != nil {
+				return err
+			}
+
+		case t.is("into") && prev.is("insert"):
+			// Изменяемая таблица и список колонок уже учтены в statement
+			_, end, err := a.relation(i+1, true)
+			if err != nil {
+				return err
+			}
+			if a.at(end).punct("(") {
+				end = a.closing(end) + 1
+			}
+			i = end - 1
+
+		case t.is("into") && !top.args:
+			return &Error{Pos: t.pos, Reason: "SELECT INTO не разрешен"}
+
+		case t.is("for") && next.is("update", "share", "no", "key") && !top.args:
+			return &Error{Pos: t.pos, Reason: "блокировка строк (FOR UPDATE/SHARE) не разрешена"}
+
+		case t.is("table") && next.name():
+			_, end, err := a.relation(i+1, false)
+			if err != nil {
+				return err
+			}
+			i = end - 1
+
+		case t.is("from") && !top.args && !prev.is("distinct"):
+			top.inFrom = true
+			end, err := a.fromItem(i + 1)
+			if err != nil {
+				return err
+			}
+			i = end - 1
+
+		case joinWords[t.text] && !next.punct("(") && !top.args:
+			top.inFrom = true
+			if t.is("join") {
+				end, err := a.fromItem(i + 1)
+				if err != nil {
+					return err
+				}
+				i = end - 1
+			}
+
+		case t.is("using") && top.inFrom && !next.punct("("):
+			end, err := a.fromItem(i + 1)
+			if err != nil {
+				return err
+			}
+			i = end - 1
+
+		case fromListEnd[t.text]:
+			top.inFrom = false
+
+		case next.punct("(") && !isKeywordBeforeParen(t) && !isTypeName(a, i) && !a.notFunction[i]:
+			a.function(a.nameEndingAt(i))
+		}
+	}
+	return nil
+}
+
+// Полное имя, которое заканчивается лексемой i: schema.func
+func (a *analyzer) nameEndingAt(i int) []token {
+	parts := []token{a.at(i)}
+	for a.at(i-1).punct(".") && a.at(i-2).name() {
+		parts = append([]token{a.at(i - 2)}, parts...)
+		i -= 2
+	}
+	return parts
+}
+
+// Слова, после которых скобка - не вызов функции
+func isKeywordBeforeParen(t token) bool {
+	return t.kind == tokIdent && nonFunctionWords[t.text] && !DefaultFunctions[t.text]
+}
+
+// Имя типа с модификатором: ::numeric(10,2), CAST(x AS varchar(20))
+func isTypeName(a *analyzer, i int) bool {
+	prev := a.at(i - 1)
+	return (prev.kind == tokOp && prev.text == "::") || prev.is("as")
+}
+
+func containsKind(kinds []Kind, k Kind) bool {
+	for _, item := range kinds {
+		if item == k {
+			return true
+		}
+	}
+	return false
+}
+
+func joinKinds(kinds []Kind) string {
+	names := make([]string, len(kinds))
+	for i, k := range kinds {
+		names[i] = string(k)
+	}
+	return strings.Join(names, ", ")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,320 @@
+package sqlguard
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testTables = map[string]bool{
+	"current_measurements": true,
+	"circuits":             true,
+}
+
+func testPolicy(kinds ...Kind) Policy {
+	return Policy{
+		Kinds:     kinds,
+		Table:     func(name string) bool { return testTables[name] },
+		Functions: DefaultFunctions,
+	}
+}
+
+var allKinds = []Kind{Select, Insert, Update, Delete}
+
+func TestValidateAccepted(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		kind      Kind
+		target    string
+		tables    []string
+		functions []string
+		params    int
+	}{
+		{
+			name:   "простой SELECT",
+			sql:    "SELECT * FROM current_measurements",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "завершающая точка с запятой",
+			sql:    "SELECT id FROM current_measurements;;",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "схема public и имя в кавычках",
+			sql:    `SELECT * FROM public."current_measurements"`,
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "соединение и USING",
+			sql:    "SELECT * FROM current_measurements m JOIN circuits c USING (circuit_id)",
+			kind:   Select,
+			tables: []string{"circuits", "current_measurements"},
+		},
+		{
+			name:   "список FROM через запятую",
+			sql:    "SELECT * FROM current_measurements m, circuits c WHERE m.circuit_id = c.id",
+			kind:   Select,
+			tables: []string{"circuits", "current_measurements"},
+		},
+		{
+			name:      "агрегаты и функции даты",
+			sql:       "SELECT date_trunc('minute', measurement_time), avg(current_value) FROM current_measurements GROUP BY 1",
+			kind:      Select,
+			tables:    []string{"current_measurements"},
+			functions: []string{"avg", "date_trunc"},
+		},
+		{
+			name:      "EXTRACT и SUBSTRING с FROM внутри",
+			sql:       "SELECT extract(epoch FROM measurement_time), substring(circuit_id FROM 1 FOR 3) FROM current_measurements",
+			kind:      Select,
+			tables:    []string{"current_measurements"},
+			functions: []string{"extract", "substring"},
+		},
+		{
+			name:   "читающий CTE",
+			sql:    "WITH recent AS (SELECT * FROM current_measurements) SELECT * FROM recent",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "рекурсивный CTE",
+			sql:    "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 5) SELECT x FROM n",
+			kind:   Select,
+			tables: nil,
+		},
+		{
+			name:   "подзапрос в FROM",
+			sql:    "SELECT * FROM (SELECT id FROM current_measurements) s",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "приведение типа с модификатором",
+			sql:    "SELECT current_value::numeric(10,2), CAST(circuit_id AS varchar(20)) FROM current_measurements",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "ключевые слова внутри строки",
+			sql:    "SELECT * FROM current_measurements WHERE circuit_id = 'x; DROP TABLE users; --'",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "ключевые слова в долларовых кавычках",
+			sql:    "SELECT * FROM current_measurements WHERE circuit_id = $tag$; DELETE FROM users$tag$",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "комментарии",
+			sql:    "SELECT * /* FROM users */ FROM current_measurements -- ; DROP TABLE users",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "WITH TIME ZONE не является CTE",
+			sql:    "SELECT measurement_time::timestamp with time zone FROM current_measurements",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+		},
+		{
+			name:   "параметры",
+			sql:    "SELECT * FROM current_measurements WHERE circuit_id = $1 AND current_value > $2",
+			kind:   Select,
+			tables: []string{"current_measurements"},
+			params: 2,
+		},
+		{
+			name:   "INSERT со списком колонок",
+			sql:    "INSERT INTO current_measurements (circuit_id, current_value) VALUES ($1, $2)",
+			kind:   Insert,
+			target: "current_measurements",
+			tables: []string{"current_measurements"},
+			params: 2,
+		},
+		{
+			name:   "INSERT из SELECT",
+			sql:    "INSERT INTO circuits (id) SELECT DISTINCT circuit_id FROM current_measurements",
+			kind:   Insert,
+			target: "circuits",
+			tables: []string{"circuits", "current_measurements"},
+		},
+		{
+			name:   "UPDATE",
+			sql:    "UPDATE current_measurements SET is_overload = true WHERE id = $1",
+			kind:   Update,
+			target: "current_measurements",
+			tables: []string{"current_measurements"},
+			params: 1,
+		},
+		{
+			name:   "ONLY и ONLY в скобках",
+			sql:    "SELECT * FROM ONLY current_measurements m, ONLY (public.circuits) c",
+			kind:   Select,
+			tables: []string{"circuits", "current_measurements"},
+		},
+		{
+			name:   "TABLE ONLY",
+			sql:    "TABLE ONLY (circuits)",
+			kind:   Select,
+			tables: []string{"circuits"},
+		},
+		{
+			name:   "TABLESAMPLE",
+			sql:    "SELECT * FROM current_measurements AS m TABLESAMPLE SYSTEM (10) REPEATABLE (1) JOIN circuits c TABLESAMPLE bernoulli (5) ON true",
+			kind:   Select,
+			tables: []string{"circuits", "current_measurements"},
+		},
+		{
+			name:      "функция в FROM со списком колонок",
+			sql:       "SELECT g.n FROM generate_series(1, 3) WITH ORDINALITY AS g(n, i) JOIN current_measurements m ON m.id = g.n",
+			kind:      Select,
+			tables:    []string{"current_measurements"},
+			functions: []string{"generate_series"},
+		},
+		{
+			name:   "DELETE с USING",
+			sql:    "DELETE FROM current_measurements m USING circuits c WHERE m.circuit_id = c.id",
+			kind:   Delete,
+			target: "current_measurements",
+			tables: []string{"circuits", "current_measurements"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Validate(tt.sql, testPolicy(allKinds...))
+			if err != nil {
+				t.Fatalf("Validate(%q): %v", tt.sql, err)
+			}
+			if stmt.Kind != tt.kind {
+				t.Errorf("Kind = %s, ожидается %s", stmt.Kind, tt.kind)
+			}
+			if stmt.Target != tt.target {
+				t.Errorf("Target = %q, ожидается %q", stmt.Target, tt.target)
+			}
+			if !reflect.DeepEqual(stmt.Tables, tt.tables) {
+				t.Errorf("Tables = %v, ожидается %v", stmt.Tables, tt.tables)
+			}
+			if tt.functions != nil && !reflect.DeepEqual(stmt.Functions, tt.functions) {
+				t.Errorf("Functions = %v, ожидается %v", stmt.Functions, tt.functions)
+			}
+			if stmt.Params != tt.params {
+				t.Errorf("Params = %d, ожидается %d", stmt.Params, tt.params)
+			}
+		})
+	}
+}
+
+func TestValidateRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		kinds  []Kind
+		reason string // фрагмент причины отказа
+	}{
+		{"пустой запрос", "  ;", allKinds, "пустой запрос"},
+		{"только комментарий", "-- SELECT 1", allKinds, "пустой запрос"},
+		{"несколько операторов", "SELECT 1; DELETE FROM current_measurements", allKinds, "только один оператор"},
+		{"несколько операторов после комментария", "SELECT 1 /* ; */; DROP TABLE users", allKinds, "только один оператор"},
+		{"DROP", "DROP TABLE current_measurements", allKinds, "DROP не разрешен"},
+		{"TRUNCATE", "TRUNCATE current_measurements", allKinds, "TRUNCATE не разрешен"},
+		{"COPY в файл", "COPY current_measurements TO '/tmp/x'", allKinds, "COPY не разрешен"},
+		{"COPY из программы", "COPY current_measurements FROM PROGRAM 'id'", allKinds, "COPY не разрешен"},
+		{"SET ROLE", "SET ROLE postgres", allKinds, "SET не разрешен"},
+		{"DO блок", "DO $$ BEGIN DELETE FROM users; END $$", allKinds, "DO не разрешен"},
+		{"запрещенный вид", "DELETE FROM current_measurements", []Kind{Select}, "DELETE не разрешен"},
+		{"изменяющий CTE", "WITH d AS (DELETE FROM current_measurements RETURNING *) SELECT * FROM d", allKinds, "изменяющий CTE"},
+		{"изменяющий CTE после читающего", "WITH a AS (SELECT 1), b AS (UPDATE circuits SET id = id RETURNING *) SELECT * FROM b", allKinds, "изменяющий CTE"},
+		{"вложенный CTE с INSERT", "SELECT * FROM (WITH i AS (INSERT INTO circuits DEFAULT VALUES RETURNING *) SELECT * FROM i) s", allKinds, "изменяющий CTE"},
+		{"SELECT INTO", "SELECT * INTO copy FROM current_measurements", allKinds, "SELECT INTO"},
+		{"SELECT INTO TEMP", "SELECT id INTO TEMP t FROM current_measurements", allKinds, "SELECT INTO"},
+		{"FOR UPDATE", "SELECT * FROM current_measurements FOR UPDATE", allKinds, "FOR UPDATE"},
+		{"недоступная таблица", "SELECT * FROM users", allKinds, "таблица users недоступна"},
+		{"таблица в подзапросе", "SELECT * FROM current_measurements WHERE id IN (SELECT id FROM users)", allKinds, "таблица users недоступна"},
+		{"таблица другой схемы", "SELECT * FROM pg_catalog.pg_authid", allKinds, "таблица pg_catalog.pg_authid недоступна"},
+		{"таблица в JOIN", "SELECT * FROM current_measurements JOIN api_keys ON true", allKinds, "таблица api_keys недоступна"},
+		{"TABLE", "TABLE users", allKinds, "таблица users недоступна"},
+		{"ONLY", "SELECT * FROM ONLY users", allKinds, "таблица users недоступна"},
+		{"ONLY в скобках", "SELECT * FROM ONLY (users)", allKinds, "таблица users недоступна"},
+		{"ONLY в скобках после запятой", "SELECT 1 FROM current_measurements, ONLY (refresh_tokens)", allKinds, "таблица refresh_tokens недоступна"},
+		{"ONLY в скобках в JOIN", "SELECT 1 FROM current_measurements JOIN ONLY (api_keys) ON true", allKinds, "таблица api_keys недоступна"},
+		{"TABLE ONLY в скобках", "TABLE ONLY (users)", allKinds, "таблица users недоступна"},
+		{"UPDATE ONLY в скобках", "UPDATE ONLY (users) SET id = id", allKinds, "таблица users недоступна"},
+		{"ONLY с лишним в скобках", "SELECT * FROM ONLY (users u)", allKinds, "ожидается )"},
+		{"непонятный элемент FROM", "SELECT * FROM 'users'", allKinds, "не удалось разобрать элемент FROM"},
+		{"пустой элемент FROM", "SELECT * FROM current_measurements,", allKinds, "не удалось разобрать элемент FROM"},
+		{"метод TABLESAMPLE", "SELECT * FROM current_measurements TABLESAMPLE system_time (1000)", allKinds, "метод выборки system_time не разрешен"},
+		{"опасная функция", "SELECT pg_sleep(10)", allKinds, "функция pg_sleep не разрешена"},
+		{"функция в кавычках", `SELECT "pg_read_file"('/etc/passwd')`, allKinds, "функция pg_read_file не разрешена"},
+		{"функция со схемой", "SELECT pg_catalog.pg_terminate_backend(1)", allKinds, "функция pg_terminate_backend не разрешена"},
+		{"функция в FROM", "SELECT * FROM dblink('host=x', 'SELECT 1') AS t(x int)", allKinds, "функция dblink не разрешена"},
+		{"функция в WHERE", "SELECT * FROM current_measurements WHERE lo_import('/etc/passwd') > 0", allKinds, "функция lo_import не разрешена"},
+		{"незакрытая строка", "SELECT 'abc FROM current_measurements", allKinds, ""},
+		{"незакрытый комментарий", "SELECT 1 /* DROP", allKinds, ""},
+		{"незакрытые долларовые кавычки", "SELECT $a$ text", allKinds, ""},
+		{"незакрытая скобка", "SELECT (1 FROM current_measurements", allKinds, "незакрытая скобка"},
+		{"лишняя скобка", "SELECT 1) FROM current_measurements", allKinds, "лишняя закрывающая скобка"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Validate(tt.sql, testPolicy(tt.kinds...))
+			if err == nil {
+				t.Fatalf("Validate(%q) пропустил запрос: %+v", tt.sql, stmt)
+			}
+			var gerr *Error
+			if !errors.As(err, &gerr) {
+				t.Fatalf("ошибка %T, ожидается *Error: %v", err, err)
+			}
+			if !strings.Contains(gerr.Reason, tt.reason) {
+				t.Errorf("причина %q, ожидается %q", gerr.Reason, tt.reason)
+			}
+			if gerr.Pos < 0 || gerr.Pos > len(tt.sql) {
+				t.Errorf("позиция %d вне запроса длины %d", gerr.Pos, len(tt.sql))
+			}
+		})
+	}
+}
+
+func TestValidateRequireParams(t *testing.T) {
+	p := testPolicy(allKinds...)
+	p.RequireParams = true
+
+	accepted := []string{
+		"SELECT * FROM current_measurements WHERE circuit_id = $1 LIMIT 10 OFFSET 20",
+		"SELECT * FROM current_measurements FETCH FIRST 5 ROWS ONLY",
+		"SELECT current_value::numeric(10,2) FROM current_measurements WHERE id = $1",
+		"SELECT CAST(circuit_id AS varchar(20)) FROM current_measurements",
+	}
+	for _, sql := range accepted {
+		if _, err := Validate(sql, p); err != nil {
+			t.Errorf("Validate(%q): %v", sql, err)
+		}
+	}
+
+	rejected := map[string]string{
+		"SELECT * FROM current_measurements WHERE circuit_id = 'circuit_B'": "'circuit_B'",
+		"SELECT * FROM current_measurements WHERE current_value > 10":       "10",
+		"UPDATE current_measurements SET current_value = 1.5 WHERE id = $1": "1.5",
+		"SELECT * FROM current_measurements WHERE circuit_id = $$x$$":       "$$x$$",
+	}
+	for sql, literal := range rejected {
+		_, err := Validate(sql, p)
+		var gerr *Error
+		if !errors.As(err, &gerr) {
+			t.Errorf("Validate(%q) пропустил константу", sql)
+			continue
+		}
+		if !strings.Contains(gerr.Reason, literal) {
+			t.Errorf("Validate(%q): причина %q, ожидается константа %s", sql, gerr.Reason, literal)
+		}
+	}
+}